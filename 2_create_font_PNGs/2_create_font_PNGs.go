@@ -25,6 +25,7 @@ type bitmapSourceInfo struct {
 	YOffset        int
 	SourceFileName string
 	FontFileName   string
+	Face           string
 }
 
 type bitmapSave struct {
@@ -254,9 +255,33 @@ func extractAndSaveFontBitmaps() error {
 			return fmt.Errorf("Font data error")
 		}
 
+		// ---------------------------
+		// 'Face' is optional, it names the style (e.g. "bold") of characters that are also in another face
+		valueFace := result["Face"]
+		switch v := valueFace.(type) {
+		case nil:
+		case string:
+			n.Face = v
+		default:
+			log.Print("'Face' field is NOT string, it's : ", result["Face"])
+			log.Printf("Font index : %v", key)
+			log.Printf("%v", results[key])
+			return fmt.Errorf("Font data error")
+		}
+
 		allFontsSource = append(allFontsSource, n)
 	}
 
+	// The same 'Character' may be in more than one face, but each must be saved to its own file
+	savedBy := make(map[string]bitmapSourceInfo)
+	for _, n := range allFontsSource {
+		if other, ok := savedBy[n.FontFileName]; ok {
+			log.Printf("'FontFileName' %v is used by '%s' (face %q) and '%s' (face %q)", n.FontFileName, other.Character, other.Face, n.Character, n.Face)
+			return fmt.Errorf("Font data error")
+		}
+		savedBy[n.FontFileName] = n
+	}
+
 	nofBitmaps := len(allFontsSource)
 
 	log.Printf("Using %d Bitmaps\n", nofBitmaps)
@@ -123,6 +123,9 @@ func textureBox(renderer *sdl.Renderer, width int, height int) (*sdl.Texture, in
 
 var allLinesReverse []string // put on global heap
 
+// The geometry of this window (these line offsets and the scroll bar areas in the
+// MouseButtonEvent handling below) is described for 4_extract_TEXT by its profile
+// 4_extract_TEXT/configuration/profiles/scroll_mock.json, keep the two in step.
 const lineOffsetX = 1
 const lineOffsetY = 63
 const lineDepth = 18
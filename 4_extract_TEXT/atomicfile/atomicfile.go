@@ -0,0 +1,41 @@
+// Package atomicfile replaces files through a temporary file renamed over them, so that a run
+// stopped part way through a save leaves the file as it was rather than cut short.
+package atomicfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces fileName with data, see Write.
+func WriteFile(fileName string, data []byte) error {
+	return Write(fileName, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Write calls write to fill a temporary file in the same directory as fileName, syncs it and
+// renames it over fileName. If write fails, the temporary file is removed and fileName is untouched.
+func Write(fileName string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err = tmp.Chmod(0644); err == nil {
+		err = write(tmp)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
@@ -0,0 +1,44 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "file.json")
+
+	for _, data := range []string{"first\n", "second, longer\n"} {
+		if err = WriteFile(fileName, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ioutil.ReadFile(fileName); err != nil || string(got) != data {
+			t.Errorf("got %q, %v, want %q", got, err, data)
+		}
+	}
+
+	// a write that fails part way leaves the file as it was
+	errFailed := errors.New("failed")
+	err = Write(fileName, func(w io.Writer) error {
+		w.Write([]byte("half"))
+		return errFailed
+	})
+	if err != errFailed {
+		t.Errorf("got %v, want the error of the write", err)
+	}
+	if got, _ := ioutil.ReadFile(fileName); string(got) != "second, longer\n" {
+		t.Errorf("after a failed write got %q", got)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 1 {
+		t.Errorf("temporary files left behind : %v", files)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+// Calibration : work out the geometry profile of a window from a screenshot of it, rather than
+// measuring it by hand with xdotool, a magnifier and an image editor.
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+	"github.com/robotn/xgb"
+	"github.com/robotn/xgb/xproto"
+)
+
+func calibrateUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s calibrate [flags] [screenshot.png]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Finds the lines of text that can be read with the font set, the line pitch, the lines per page\n")
+		fmt.Fprintf(fs.Output(), "and the scroll bar of the window in the screenshot (or the screen, if none is given), and writes\n")
+		fmt.Fprintf(fs.Output(), "a geometry profile, along with a copy of the screenshot marked up with what was found to check it.\n\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runCalibrate is the 'calibrate' command.
+func runCalibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	anchorPath := fs.String("anchor", defaultProfile().Anchor, ".png of part of the window that does not scroll, e.g. its title")
+	name := fs.String("name", "", "name of the profile (default the name of the anchor .png)")
+	outPath := fs.String("out", "", "profile file to write (default configuration/profiles/<name>.json)")
+	imagePath := fs.String("image", "calibrate.png", "marked up copy of the screenshot to write")
+	configPath := fs.String("config", "./configuration/config.json", "path to config file")
+	fs.Usage = calibrateUsage(fs)
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("only ONE screenshot can be given")
+	}
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(*anchorPath), filepath.Ext(*anchorPath))
+	}
+	if *outPath == "" {
+		*outPath = filepath.Join("configuration", "profiles", *name+".json")
+	}
+
+	var img image.Image
+	var err error
+	if fs.NArg() == 1 {
+		img, err = readPNG(fs.Arg(0))
+	} else {
+		img, err = grabScreen()
+	}
+	if err != nil {
+		return err
+	}
+	anchor, err := readPNG(*anchorPath)
+	if err != nil {
+		return err
+	}
+
+	fonts, err := loadFontBitmaps()
+	if err != nil {
+		return err
+	}
+	config, _ := getConfig(*configPath)
+	config.UnknownGlyphsDir = "" // everything that is not text is unknown
+	options, err := recognizerOptions(config)
+	if err != nil {
+		return err
+	}
+	options.GatherCharacterCounts = false
+	rec, err := recognizer.New(fonts, options)
+	if err != nil {
+		return err
+	}
+
+	anchorX, anchorY, ok := findImage(img, anchor)
+	if !ok {
+		return fmt.Errorf("can not find %v in the screenshot", *anchorPath)
+	}
+	log.Printf("Anchor %v found at %v, %v", *anchorPath, anchorX, anchorY)
+
+	c := newCalibration(img, rec, fonts)
+	if err = c.findTextArea(); err != nil {
+		return err
+	}
+	log.Printf("Text area at %v, %v, %v wide, %v lines %v apart", c.text.Min.X, c.text.Min.Y, c.text.Dx(), c.lines, c.pitch)
+	if err = c.findScrollBar(); err != nil {
+		return err
+	}
+	log.Printf("Scroll bar at %v, %v, %v wide, %v high", c.bar.Min.X, c.bar.Min.Y, c.bar.Dx(), c.bar.Dy())
+	grip, ok := c.findGrip()
+	if ok {
+		log.Printf("Grip of the scroll bar taken to be #%06x", grip)
+	} else {
+		log.Printf("No grip found in the scroll bar, so the profile has no 'ScrollTrack'")
+	}
+
+	p := c.profile(*name, *anchorPath, anchorX, anchorY, anchor.Bounds())
+	if ok {
+		p.ScrollTrack = c.scrollTrack(grip, anchorX, anchorY)
+	}
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(*outPath), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(*outPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	log.Printf("Profile written to %v", *outPath)
+
+	if err = c.saveMarkedUp(*imagePath, p, anchorX, anchorY, anchor.Bounds()); err != nil {
+		return err
+	}
+	log.Printf("Check %v : the text area is outlined in green with a tick at each line, the scroll bar in blue,", *imagePath)
+	log.Printf("  the anchor in yellow, and the places clicked are crosses : LineUp/LineDown red, PageUp/PageDown magenta, Focus orange")
+	return nil
+}
+
+// calibration holds a screenshot and what has been found in it.
+type calibration struct {
+	img    image.Image
+	pix    []byte // img laid out as X11 ZPixmap data, for the recognizer
+	stride int
+	rec    *recognizer.Recognizer
+	strip  int // rows of pixels needed to decode a line, in all faces
+
+	text       image.Rectangle // the lines of text
+	pitch      int
+	lines      int
+	background uint32          // of the lines
+	bar        image.Rectangle // the scroll bar
+}
+
+func newCalibration(img image.Image, rec *recognizer.Recognizer, fonts *recognizer.FontSet) *calibration {
+	c := &calibration{img: img, rec: rec}
+	bounds := img.Bounds()
+	c.stride = bounds.Dx() * 4
+	c.pix = make([]byte, c.stride*bounds.Dy())
+	for i, p := range toRGB(img) {
+		c.pix[i*4] = uint8(p)
+		c.pix[i*4+1] = uint8(p >> 8)
+		c.pix[i*4+2] = uint8(p >> 16)
+	}
+	for _, f := range fonts.Faces {
+		if f.YOffset+f.Height > c.strip {
+			c.strip = f.YOffset + f.Height
+		}
+	}
+	return c
+}
+
+// rgb returns the colour of the pixel at x, y of the screenshot as 0x00RRGGBB.
+func (c *calibration) rgb(x int, y int) uint32 {
+	offset := (y-c.img.Bounds().Min.Y)*c.stride + (x-c.img.Bounds().Min.X)*4
+	return uint32(c.pix[offset+2])<<16 | uint32(c.pix[offset+1])<<8 | uint32(c.pix[offset])
+}
+
+// rect converts a rectangle of the screenshot into one of c.pix.
+func (c *calibration) rect(r image.Rectangle) image.Rectangle {
+	return r.Sub(c.img.Bounds().Min)
+}
+
+// findTextArea finds the rows of the screenshot at which a line of text decodes into a valid row,
+// and from them the line pitch and the longest run of lines that pitch apart.
+func (c *calibration) findTextArea() error {
+	bounds := c.img.Bounds()
+
+	// the rows at which characters are found across the whole width, and the columns they span
+	type textRow struct {
+		y          int
+		minX, maxX int
+	}
+	var rows []textRow
+	for y := bounds.Min.Y; y+c.strip <= bounds.Max.Y; y++ {
+		matches, err := c.rec.DecodeMatches(c.pix, c.stride, c.rect(image.Rect(bounds.Min.X, y, bounds.Max.X, y+c.strip)))
+		if err != nil || len(matches) == 0 {
+			continue
+		}
+		first, last := matches[0], matches[len(matches)-1]
+		r := textRow{y: y, minX: bounds.Min.X + first.X, maxX: bounds.Min.X + last.X + last.Width}
+		if _, err = c.rec.Row(c.pix, c.stride, c.rect(image.Rect(r.minX, y, r.maxX, y+c.strip))); err == nil {
+			rows = append(rows, r)
+		}
+	}
+	if len(rows) < 2 {
+		return fmt.Errorf("found %v line(s) of text that could be read, at least 2 are needed to measure the line pitch", len(rows))
+	}
+
+	// a row can be read at a few neighbouring y when its glyphs have blank rows, so take the middle of each such run
+	var lineRows []textRow
+	for i := 0; i < len(rows); {
+		j := i
+		for j+1 < len(rows) && rows[j+1].y == rows[j].y+1 {
+			j++
+		}
+		lineRows = append(lineRows, rows[(i+j)/2])
+		i = j + 1
+	}
+
+	// the pitch is the most common distance between lines
+	gaps := make(map[int]int)
+	for i := 1; i < len(lineRows); i++ {
+		gaps[lineRows[i].y-lineRows[i-1].y]++
+	}
+	for gap, n := range gaps {
+		if n > gaps[c.pitch] || (n == gaps[c.pitch] && gap < c.pitch) {
+			c.pitch = gap
+		}
+	}
+	if c.pitch < c.strip {
+		return fmt.Errorf("lines are %v rows of pixels apart, but the font set needs %v", c.pitch, c.strip)
+	}
+
+	// the longest run of lines that far apart
+	bestStart, bestLen := 0, 0
+	for i := 0; i < len(lineRows); {
+		j := i
+		for j+1 < len(lineRows) && lineRows[j+1].y == lineRows[j].y+c.pitch {
+			j++
+		}
+		if j-i+1 > bestLen {
+			bestStart, bestLen = i, j-i+1
+		}
+		i = j + 1
+	}
+	run := lineRows[bestStart : bestStart+bestLen]
+	c.lines = len(run)
+
+	minX, maxX := run[0].minX, run[0].maxX
+	for _, r := range run {
+		if r.minX < minX {
+			minX = r.minX
+		}
+		if r.maxX > maxX {
+			maxX = r.maxX
+		}
+	}
+	top := run[0].y
+	bottom := top + c.lines*c.pitch
+
+	// widen the area out to the edges of the background the text is on, so longer lines still fit
+	c.background = c.mostCommonColour(image.Rect(minX, top, maxX, bottom))
+	for minX > bounds.Min.X && c.columnIs(minX-1, top, bottom, c.background) {
+		minX--
+	}
+	for maxX < bounds.Max.X && c.columnIs(maxX, top, bottom, c.background) {
+		maxX++
+	}
+	c.text = image.Rect(minX, top, maxX, bottom)
+	return nil
+}
+
+func (c *calibration) mostCommonColour(r image.Rectangle) uint32 {
+	counts := make(map[uint32]int)
+	var best uint32
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p := c.rgb(x, y)
+			counts[p]++
+			if counts[p] > counts[best] {
+				best = p
+			}
+		}
+	}
+	return best
+}
+
+// columnIs is true if column x is all colour from row top down to bottom.
+func (c *calibration) columnIs(x int, top int, bottom int, colour uint32) bool {
+	for y := top; y < bottom; y++ {
+		if c.rgb(x, y) != colour {
+			return false
+		}
+	}
+	return true
+}
+
+// findScrollBar looks to the right of the text area for a scroll bar: the first run of at least
+// 5 columns of one colour, not that of the lines, half way down the text area. It is taken to
+// be as high as the text area, with square arrow buttons at each end.
+func (c *calibration) findScrollBar() error {
+	bounds := c.img.Bounds()
+	midY := c.text.Min.Y + c.text.Dy()/2
+	limit := c.text.Max.X + 3*c.pitch
+	if limit > bounds.Max.X {
+		limit = bounds.Max.X
+	}
+	for x := c.text.Max.X; x < limit; {
+		colour := c.rgb(x, midY)
+		end := x + 1
+		for end < limit && c.rgb(end, midY) == colour {
+			end++
+		}
+		if colour != c.background && end-x >= 5 {
+			c.bar = image.Rect(x, c.text.Min.Y, end, c.text.Max.Y)
+			return nil
+		}
+		x = end
+	}
+	return fmt.Errorf("no scroll bar found to the right of the text area, between x %v and %v", c.text.Max.X, limit)
+}
+
+// track is the column of pixels down the middle of the scroll bar, between its arrow buttons.
+func (c *calibration) track() image.Rectangle {
+	barX := c.bar.Min.X + c.bar.Dx()/2
+	button := c.bar.Dx() // the arrow buttons are taken to be square
+	return image.Rect(barX, c.bar.Min.Y+button, barX+1, c.bar.Max.Y-button)
+}
+
+// findGrip guesses the colour of the grip of the scroll bar: of the colours down its track, the most
+// common after that of the track itself.
+func (c *calibration) findGrip() (uint32, bool) {
+	t := c.track()
+	counts := make(map[uint32]int)
+	for y := t.Min.Y; y < t.Max.Y; y++ {
+		counts[c.rgb(t.Min.X, y)]++
+	}
+	var track, grip uint32
+	for colour, n := range counts {
+		if n > counts[track] || n == counts[track] && colour < track {
+			track = colour
+		}
+	}
+	found := false
+	for colour, n := range counts {
+		if colour != track && (!found || n > counts[grip] || n == counts[grip] && colour < grip) {
+			grip, found = colour, true
+		}
+	}
+	return grip, found
+}
+
+// scrollTrack returns the track of the scroll bar in which the grip is colour grip, relative to the
+// anchor found at anchorX, anchorY.
+func (c *calibration) scrollTrack(grip uint32, anchorX int, anchorY int) *scrollTrack {
+	t := c.track()
+	return &scrollTrack{X: t.Min.X - anchorX, Y: t.Min.Y - anchorY, Height: t.Dy(), GripColour: fmt.Sprintf("#%06x", grip)}
+}
+
+// profile returns the profile of what has been found, relative to the anchor found at anchorX, anchorY.
+func (c *calibration) profile(name string, anchorFile string, anchorX int, anchorY int, anchorBounds image.Rectangle) *geometryProfile {
+	rel := func(x int, y int) point { return point{X: x - anchorX, Y: y - anchorY} }
+	barX := c.bar.Min.X + c.bar.Dx()/2
+	button := c.bar.Dx() // the arrow buttons are taken to be square
+
+	p := &geometryProfile{
+		Name:         name,
+		Anchor:       anchorFile,
+		LinePitch:    c.pitch,
+		LinesPerPage: c.lines,
+		Focus:        point{X: anchorBounds.Dx() / 2, Y: anchorBounds.Dy() / 2},
+		LineUp:       rel(barX, c.bar.Min.Y+button/2),
+		LineDown:     rel(barX, c.bar.Max.Y-button/2),
+		PageUp:       rel(barX, c.bar.Min.Y+3*button),
+		PageDown:     rel(barX, c.bar.Max.Y-button), // the bottom of the track, 'PageDownOffset' above it is clicked
+	}
+	p.TextArea.X = c.text.Min.X - anchorX
+	p.TextArea.Y = c.text.Min.Y - anchorY
+	p.TextArea.Width = c.text.Dx()
+	return p
+}
+
+// saveMarkedUp saves a copy of the screenshot with the profile p drawn on it.
+func (c *calibration) saveMarkedUp(fileName string, p *geometryProfile, anchorX int, anchorY int, anchorBounds image.Rectangle) error {
+	marked := image.NewRGBA(c.img.Bounds())
+	draw.Draw(marked, marked.Bounds(), c.img, c.img.Bounds().Min, draw.Src)
+
+	green := color.RGBA{0x00, 0xC0, 0x00, 0xFF}
+	outline(marked, c.text, green)
+	for i := 1; i < c.lines; i++ {
+		y := c.text.Min.Y + i*c.pitch
+		for x := c.text.Min.X - 6; x < c.text.Min.X; x++ {
+			marked.Set(x, y, green)
+		}
+	}
+	outline(marked, c.bar, color.RGBA{0x00, 0x00, 0xFF, 0xFF})
+	outline(marked, anchorBounds.Sub(anchorBounds.Min).Add(image.Pt(anchorX, anchorY)), color.RGBA{0xFF, 0xD0, 0x00, 0xFF})
+
+	red := color.RGBA{0xFF, 0x00, 0x00, 0xFF}
+	magenta := color.RGBA{0xFF, 0x00, 0xFF, 0xFF}
+	cross(marked, p.LineUp, anchorX, anchorY, red)
+	cross(marked, p.LineDown, anchorX, anchorY, red)
+	cross(marked, p.PageUp, anchorX, anchorY, magenta)
+	cross(marked, p.PageDown, anchorX, anchorY, magenta)
+	cross(marked, p.Focus, anchorX, anchorY, color.RGBA{0xFF, 0x80, 0x00, 0xFF})
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, marked); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// outline draws a one pixel line just outside of r.
+func outline(img *image.RGBA, r image.Rectangle, colour color.Color) {
+	r = r.Inset(-1)
+	for x := r.Min.X; x < r.Max.X; x++ {
+		img.Set(x, r.Min.Y, colour)
+		img.Set(x, r.Max.Y-1, colour)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		img.Set(r.Min.X, y, colour)
+		img.Set(r.Max.X-1, y, colour)
+	}
+}
+
+// cross draws a small cross at p.
+func cross(img *image.RGBA, p point, anchorX int, anchorY int, colour color.Color) {
+	x, y := p.at(anchorX, anchorY)
+	for d := -4; d <= 4; d++ {
+		img.Set(x+d, y, colour)
+		img.Set(x, y+d, colour)
+	}
+}
+
+// grabScreen returns the whole of the X display's default screen.
+func grabScreen() (image.Image, error) {
+	c, err := xgb.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	screen := xproto.Setup(c).DefaultScreen(c)
+	width, height := int(screen.WidthInPixels), int(screen.HeightInPixels)
+
+	source := &x11Source{c: c, drawable: xproto.Drawable(screen.Root)}
+	data, err := source.Grab(image.Rect(0, 0, width, height))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < width*height*4 {
+		return nil, fmt.Errorf("screen grab is %v bytes, not the %v expected", len(data), width*height*4)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		img.Pix[i*4] = data[i*4+2] // BGRX to RGBA
+		img.Pix[i*4+1] = data[i*4+1]
+		img.Pix[i*4+2] = data[i*4]
+		img.Pix[i*4+3] = 0xFF
+	}
+	return img, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+// Checkpoints of a live scrape, so that one stopped part way (e.g. by a stray mouse movement)
+// can be carried on with '-resume' rather than started again from the top.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/output"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/scrape"
+)
+
+// streamRows returns the scrape.Scraper Confirmed hook that appends the rows of each confirmed page
+// (or single line) to the stream, along with the checkpoint of the scrape after them.
+func streamRows(stream *output.Stream) func(rows []recognizer.Row, cp *scrape.Checkpoint) error {
+	return func(rows []recognizer.Row, cp *scrape.Checkpoint) error {
+		stream.SetCheckpoint(cp)
+		if err := stream.Write(rows); err != nil {
+			return fmt.Errorf("writing to %v : %v", stream.FileName(), err)
+		}
+		return nil
+	}
+}
+
+// resumeStream opens the stream of a run that did not complete and returns the checkpoint it got to.
+func resumeStream(format string, schema *recognizer.Schema, syncInterval time.Duration) (*output.Stream, *scrape.Checkpoint, error) {
+	stream, status, err := output.ResumeStream(streamFileName(format), schema, syncInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status.Format != format {
+		stream.Close(false, status.Reason)
+		return nil, nil, fmt.Errorf("%v is of format %q, not %q", stream.FileName(), status.Format, format)
+	}
+	cp := &scrape.Checkpoint{}
+	if len(status.Checkpoint) == 0 {
+		stream.Close(false, status.Reason)
+		return nil, nil, fmt.Errorf("%v has no checkpoint to resume from", output.StatusFile(stream.FileName()))
+	}
+	if err = json.Unmarshal(status.Checkpoint, cp); err != nil {
+		stream.Close(false, status.Reason)
+		return nil, nil, fmt.Errorf("checkpoint in %v : %v", output.StatusFile(stream.FileName()), err)
+	}
+	log.Printf("Resuming from %v rows and %v pages, %v phase", status.Rows, cp.Pages, cp.Phase)
+	return stream, cp, nil
+}
@@ -0,0 +1,9 @@
+// Package e2e has the end to end test of the extractor: on a private Xvfb display, 3_scroll_window_Mock
+// shows a generated data file, the extractor scrapes it, and what it extracts is compared with the file.
+// It is what 6_test_to_failure does, without needing a desktop that nobody touches.
+//
+// It is skipped where Xvfb is not installed, and the largest data sizes are skipped with -short:
+//
+//	go test ./e2e -v -timeout 30m
+//	go test ./e2e -v -args -sizes 10600,10599
+package e2e
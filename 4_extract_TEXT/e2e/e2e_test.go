@@ -0,0 +1,347 @@
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robotn/xgb"
+	"github.com/robotn/xgb/xproto"
+)
+
+var sizesFlag = flag.String("sizes", "", "comma separated numbers of lines to extract, rather than the table of runs")
+
+const (
+	repoRoot  = "../.."
+	mockTitle = "scroll window Mock"
+)
+
+// extractRun is one run of the extractor against the mock showing a generated data file.
+type extractRun struct {
+	name   string
+	lines  int
+	args   []string // for the extractor
+	exit   int      // the exit code of the extractor, when it is not to extract the lines
+	events bool     // check the completion of the event stream, written to events.jsonl
+	long   bool     // skipped with -short
+}
+
+var extractRuns = []extractRun{
+	{name: "one page", lines: 50},
+	{name: "one page and a line", lines: 51},
+	{name: "two pages", lines: 100},
+	{name: "many pages", lines: 1000},
+	{name: "keys", lines: 1000, args: []string{"-scroll", "keys"}},
+	{name: "by window title", lines: 1000, args: []string{"-window-name", mockTitle}},
+	{name: "no such window", lines: 50, args: []string{"-window-name", "no such window"}, exit: 3},
+	{name: "events", lines: 100, args: []string{"-events", "json", "-events-file", "events.jsonl"}, events: true},
+
+	// where the last page downs of 6_test_to_failure start to scroll less than a page
+	{name: "10601", lines: 10601, long: true},
+	{name: "10600", lines: 10600, long: true},
+	{name: "10599", lines: 10599, long: true},
+}
+
+func TestExtract(t *testing.T) {
+	xvfb, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb is not installed")
+	}
+
+	runs := extractRuns
+	if *sizesFlag != "" {
+		runs = nil
+		for _, size := range strings.Split(*sizesFlag, ",") {
+			lines, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil {
+				t.Fatalf("-sizes : %v", err)
+			}
+			runs = append(runs, extractRun{name: strconv.Itoa(lines), lines: lines})
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	mock := build(t, "3_scroll_window_Mock", tmp)
+	extract := build(t, "4_extract_TEXT", tmp)
+	display, stopXvfb := startXvfb(t, xvfb)
+	defer stopXvfb()
+
+	for i, run := range runs {
+		run := run
+		dir := filepath.Join(tmp, fmt.Sprintf("run_%v", i))
+		t.Run(run.name, func(t *testing.T) {
+			if run.long && testing.Short() {
+				t.Skip("skipped with -short")
+			}
+			extractAndCompare(t, run, dir, display, mock, extract)
+		})
+	}
+}
+
+// extractAndCompare shows the data of run in the mock, extracts it, and compares the two.
+func extractAndCompare(t *testing.T, run extractRun, dir string, display string, mock string, extract string) {
+	data := generateData(run.lines)
+	mockDir, extractDir, dataFile := layout(t, dir, data)
+	env := append(os.Environ(), "DISPLAY="+display, "SDL_RENDER_DRIVER=software")
+
+	mockLog, err := os.Create(filepath.Join(dir, "mock.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockLog.Close()
+	mockCmd := exec.Command(mock, "-mock", dataFile)
+	mockCmd.Dir = mockDir
+	mockCmd.Env = env
+	mockCmd.Stdout, mockCmd.Stderr = mockLog, mockLog
+	if err = mockCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mockCmd.Process.Kill()
+		mockCmd.Wait()
+	}()
+	if err = waitForWindow(display, mockTitle, 10*time.Second); err != nil {
+		t.Fatalf("%v, mock log :\n%v", err, tail(filepath.Join(dir, "mock.log"), 20))
+	}
+	time.Sleep(time.Second) // for the first page to be drawn
+
+	// about 7ms a line on the development machine, with plenty to spare
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute+time.Duration(run.lines)*20*time.Millisecond)
+	defer cancel()
+	extractCmd := exec.CommandContext(ctx, extract, append([]string{"-config", "e2e_config.json"}, run.args...)...)
+	extractCmd.Dir = extractDir
+	extractCmd.Env = env
+	out, err := extractCmd.CombinedOutput()
+	ioutil.WriteFile(filepath.Join(dir, "extract.log"), out, 0644)
+	if run.exit != 0 {
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != run.exit {
+			t.Fatalf("extractor : got %v, want exit code %v\n%v", err, run.exit, tail(filepath.Join(dir, "extract.log"), 40))
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("extractor : %v\n%v", err, tail(filepath.Join(dir, "extract.log"), 40))
+	}
+
+	extracted, err := readLines(filepath.Join(extractDir, "extracted_text.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(data) && i < len(extracted); i++ {
+		if extracted[i] != data[i] {
+			t.Fatalf("line %v is %q, want %q", i+1, extracted[i], data[i])
+		}
+	}
+	if len(extracted) != len(data) {
+		t.Fatalf("extracted %v lines, want %v", len(extracted), len(data))
+	}
+
+	if run.events {
+		events, err := readLines(filepath.Join(extractDir, "events.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var complete struct {
+			Event string
+			Rows  int
+		}
+		if err = json.Unmarshal([]byte(events[len(events)-1]), &complete); err != nil {
+			t.Fatal(err)
+		}
+		if complete.Event != "complete" || complete.Rows != len(data) {
+			t.Fatalf("the last event is %v, want the completion of %v rows", events[len(events)-1], len(data))
+		}
+	}
+}
+
+// build builds the program in folder dir of the repository, into out.
+func build(t *testing.T, dir string, out string) string {
+	binary := filepath.Join(out, dir)
+	cmd := exec.Command("go", "build", "-o", binary, ".")
+	cmd.Dir = filepath.Join(repoRoot, dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building %v : %v\n%s", dir, err, output)
+	}
+	return binary
+}
+
+// startXvfb starts a display of its own, and returns its name and how to stop it.
+func startXvfb(t *testing.T, xvfb string) (string, func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cmd := exec.Command(xvfb, "-displayfd", "3", "-screen", "0", "1280x1024x24", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w} // fd 3, on which Xvfb writes the number of the display it picked
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	number := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		number <- strings.TrimSpace(line)
+	}()
+	select {
+	case n := <-number:
+		if n == "" {
+			stop()
+			t.Fatal("Xvfb did not start")
+		}
+		return ":" + n, stop
+	case <-time.After(10 * time.Second):
+		stop()
+		t.Fatal("Xvfb did not start within 10 seconds")
+	}
+	return "", stop
+}
+
+// waitForWindow waits for a window titled title to be shown on display.
+func waitForWindow(display string, title string, timeout time.Duration) error {
+	c, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	root := xproto.Setup(c).DefaultScreen(c).Root
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		tree, err := xproto.QueryTree(c, root).Reply()
+		if err != nil {
+			return err
+		}
+		for _, win := range tree.Children {
+			attributes, err := xproto.GetWindowAttributes(c, win).Reply()
+			if err != nil || attributes.MapState != xproto.MapStateViewable {
+				continue
+			}
+			name, err := xproto.GetProperty(c, false, win, xproto.AtomWmName, xproto.GetPropertyTypeAny, 0, 256).Reply()
+			if err == nil && string(name.Value) == title {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no window titled %q was shown within %v", title, timeout)
+}
+
+// layout puts the folders the mock and the extractor expect to find around them in dir, with the data
+// file, so that nothing they write ends up in the repository. It returns where to run each from.
+func layout(t *testing.T, dir string, data []string) (mockDir string, extractDir string, dataFile string) {
+	root, err := filepath.Abs(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockDir = filepath.Join(dir, "3_scroll_window_Mock")
+	extractDir = filepath.Join(dir, "4_extract_TEXT")
+	dataFile = filepath.Join(dir, "mock_data.csv")
+	for _, d := range []string{mockDir, extractDir} {
+		if err = os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// read only, so shared with the repository
+	for _, link := range []string{
+		"2_create_font_PNGs",
+		"3_scroll_window_Mock/sprites",
+		"4_extract_TEXT/configuration",
+		"4_extract_TEXT/scroll_mock.png",
+	} {
+		if err = os.Symlink(filepath.Join(root, link), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the font description is written to by a run that gathers character counts, so is copied
+	fonts, err := ioutil.ReadFile(filepath.Join(root, "4_extract_TEXT/optimised_character_info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(extractDir, "optimised_character_info.json"), fonts, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the repository's config, with the rows written as they are scraped and nothing else saved
+	config := map[string]interface{}{}
+	configData, err := ioutil.ReadFile(filepath.Join(root, "4_extract_TEXT/configuration/config.json"))
+	if err == nil {
+		err = json.Unmarshal(configData, &config)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	config["GatherCharacterCounts"] = 0
+	config["UnknownGlyphsDir"] = ""
+	config["OutputFormat"] = "text"
+	if configData, err = json.MarshalIndent(config, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(extractDir, "e2e_config.json"), configData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(dataFile, []byte(strings.Join(data, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return mockDir, extractDir, dataFile
+}
+
+// generateData returns n lines like those of 1_mock_data.py: each second a few doors open or close,
+// giving a line of the time, an index, the floor, the door and whether it is now open.
+// The lines are the same every time for the same n.
+func generateData(n int) []string {
+	rng := rand.New(rand.NewSource(int64(n)))
+	var doors [10][20]int
+	lines := make([]string, 0, n)
+	for second := 0; len(lines) < n; second++ {
+		for changes := rng.Intn(4); changes > 0 && len(lines) < n; changes-- {
+			floor, door := rng.Intn(10), rng.Intn(20)
+			doors[floor][door] = 1 - doors[floor][door]
+			lines = append(lines, fmt.Sprintf("%02d:%02d:%02d,%d,%d,%d,%d",
+				second/3600, second/60%60, second%60, len(lines)+1, floor+1, door+1, doors[floor][door]))
+		}
+	}
+	return lines
+}
+
+func readLines(fileName string) ([]string, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// tail returns the last n lines of a log file.
+func tail(fileName string, n int) string {
+	data, _ := ioutil.ReadFile(fileName)
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return string(bytes.Join(lines, []byte("\n")))
+}
@@ -0,0 +1,147 @@
+// Package events is the progress of a live run as a stream of JSON objects, one per line, for a program
+// driving the extractor to follow rather than its log.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The kinds of event, the Event of an Event.
+const (
+	AnchorFound   = "anchor_found"    // the window to scrape has been found
+	PageCaptured  = "page_captured"   // a page has been grabbed and has stopped changing
+	LinesAppended = "lines_appended"  // rows have been added to those scraped
+	Retry         = "retry"           // a grab changed under the scrape, a page did not overlap the one before, or a line down was lost, so it is being done again
+	Stall         = "stall"           // the window has not changed since it was scrolled
+	Warning       = "warning"         // something the scrape could not be sure of, see Reason
+	PhaseChange   = "phase"           // the scrape has moved on to another Phase
+	EndOfDocument = "end_of_document" // the last line has been scraped, for the Reason given
+	Complete      = "complete"        // the run has ended, successfully or not, and nothing follows
+)
+
+// The phases of a scrape.
+const (
+	PhasePaging       = "paging"       // scrolling a page at a time
+	PhaseSingleLine   = "single_line"  // scrolling a line at a time, after the pages have run out
+	PhaseVerification = "verification" // checking the last pages against the rows scraped
+)
+
+// Event is one line of the stream. Only the fields that go with its kind are set.
+type Event struct {
+	Event     string // one of the kinds above
+	Time      time.Time
+	ElapsedMS int64 // since the Writer was created
+
+	Phase  string `json:",omitempty"` // the phase the scrape is in
+	Page   int    `json:",omitempty"` // pages (and single lines) scrolled, of PageCaptured
+	Lines  int    `json:",omitempty"` // appended, of LinesAppended
+	Rows   int    `json:",omitempty"` // scraped so far, of LinesAppended and Complete
+	Reason string `json:",omitempty"` // of a Retry, Stall, Warning or EndOfDocument
+
+	// of PageCaptured, where the grip of the scroll bar is, in rows of pixels from the top of its track
+	GripTop, GripSize int `json:",omitempty"`
+
+	// of LinesAppended, estimated from the grip : the lines of the document, the percentage of them
+	// scraped, and how much longer the rest will take
+	TotalLines int     `json:",omitempty"`
+	Percent    float64 `json:",omitempty"`
+	ETAMS      int64   `json:",omitempty"`
+
+	// of AnchorFound : where the anchor is on screen, and the window picked by '-window-id' or '-window-name'
+	AnchorX, AnchorY int    `json:",omitempty"`
+	Window           string `json:",omitempty"`
+
+	// of Complete
+	ExitCode  int              `json:",omitempty"`
+	Error     string           `json:",omitempty"`
+	TimingsMS map[string]int64 `json:",omitempty"` // time spent in each phase
+}
+
+// Writer writes events to a file, or to stdout. It is safe for concurrent use, and a nil *Writer
+// writes nothing, so that a run without an event stream need not check for one.
+type Writer struct {
+	mu         sync.Mutex
+	enc        *json.Encoder
+	closer     io.Closer // nil for stdout
+	err        error     // the first error writing an event
+	start      time.Time
+	phase      string
+	phaseStart time.Time
+	timings    map[string]time.Duration
+}
+
+// Open returns a Writer of the events to fileName, "-" for stdout.
+func Open(fileName string) (*Writer, error) {
+	if fileName == "-" {
+		return NewWriter(os.Stdout, nil), nil
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriter(file, file), nil
+}
+
+// NewWriter returns a Writer of the events to w, closing closer (if not nil) on Close.
+func NewWriter(w io.Writer, closer io.Closer) *Writer {
+	return &Writer{enc: json.NewEncoder(w), closer: closer, start: time.Now(), timings: make(map[string]time.Duration)}
+}
+
+// Emit writes e, stamped with the time. A PhaseChange starts the timing of its phase, and a Complete is
+// given the time spent in each phase.
+func (w *Writer) Emit(e Event) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e.Time = time.Now()
+	e.ElapsedMS = e.Time.Sub(w.start).Milliseconds()
+	switch e.Event {
+	case PhaseChange:
+		w.endPhase(e.Time)
+		w.phase, w.phaseStart = e.Phase, e.Time
+	case Complete:
+		w.endPhase(e.Time)
+		e.TimingsMS = make(map[string]int64)
+		for phase, d := range w.timings {
+			e.TimingsMS[phase] = d.Milliseconds()
+		}
+		e.TimingsMS["total"] = e.ElapsedMS
+	}
+	if err := w.enc.Encode(e); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *Writer) endPhase(now time.Time) {
+	if w.phase != "" {
+		w.timings[w.phase] += now.Sub(w.phaseStart)
+		w.phase = ""
+	}
+}
+
+// Close closes the file of the events, returning the first error writing them, if any.
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("writing events : %v", err)
+	}
+	return nil
+}
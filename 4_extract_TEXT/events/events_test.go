@@ -0,0 +1,58 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	w.Emit(Event{Event: AnchorFound, AnchorX: 10, AnchorY: 14})
+	w.Emit(Event{Event: PhaseChange, Phase: PhasePaging})
+	time.Sleep(20 * time.Millisecond)
+	w.Emit(Event{Event: LinesAppended, Phase: PhasePaging, Lines: 50, Rows: 50})
+	w.Emit(Event{Event: PhaseChange, Phase: PhaseSingleLine})
+	w.Emit(Event{Event: Complete, Rows: 50})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("%q : %v", scanner.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 5 {
+		t.Fatalf("got %v events, want 5", len(got))
+	}
+	if got[0].Event != AnchorFound || got[0].AnchorX != 10 || got[0].AnchorY != 14 {
+		t.Errorf("got %+v, want the anchor", got[0])
+	}
+	if got[2].Lines != 50 || got[2].Time.IsZero() {
+		t.Errorf("got %+v, want 50 lines at a time", got[2])
+	}
+
+	complete := got[4]
+	if complete.TimingsMS[PhasePaging] < 20 || complete.TimingsMS["total"] < complete.TimingsMS[PhasePaging] {
+		t.Errorf("got timings %v, want at least 20ms of paging", complete.TimingsMS)
+	}
+	if _, ok := complete.TimingsMS[PhaseSingleLine]; !ok {
+		t.Errorf("got timings %v, want the single line phase ended by the completion", complete.TimingsMS)
+	}
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+	w.Emit(Event{Event: Complete})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
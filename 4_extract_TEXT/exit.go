@@ -0,0 +1,159 @@
+package main
+
+// The one way out of the extractor. Whatever stops a run, the mouse is put back, the rows confirmed so far
+// are kept for '-resume', a summary is logged, and the exit code says what kind of thing stopped it.
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/events"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/output"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/scrape"
+)
+
+// Exit codes, by what stopped the run. Scripts can rely on these, see note 24 of docs/technical-notes.txt.
+const (
+	exitOK                   = 0
+	exitFailed               = 1  // anything else, e.g. a failed fonts, reverse, calibrate or ocr command
+	exitConfig               = 2  // the config file, a flag, the profile, the schema or the font set
+	exitWindowNotFound       = 3  // no anchor on screen, or no window of '-window-id' or '-window-name' to scrape, or it is covered
+	exitCaptureFailure       = 4  // no connection to the X server, a failed grab, or a black line grabbed
+	exitFontMismatch         = 5  // the pixels of a line are not those of the font
+	exitSchemaViolation      = 6  // a line was read, but is not a row of the schema
+	exitUserAbort            = 7  // the mouse moved to the far left of the screen, Ctrl-C or SIGTERM
+	exitVerificationMismatch = 8  // the last pages are not the last rows scraped
+	exitOutputFailure        = 9  // the rows could not be written
+	exitResumeFailure        = 10 // nothing to '-resume' from, or its screen was not scrolled to
+	exitScrollGap            = 11 // a page could not be lined up with the one before, so rows may have been missed
+)
+
+var exitNames = map[int]string{
+	exitFailed:               "failure",
+	exitConfig:               "configuration error",
+	exitWindowNotFound:       "window not found",
+	exitCaptureFailure:       "capture failure",
+	exitFontMismatch:         "font mismatch",
+	exitSchemaViolation:      "schema violation",
+	exitUserAbort:            "user abort",
+	exitVerificationMismatch: "verification mismatch",
+	exitOutputFailure:        "output failure",
+	exitResumeFailure:        "resume failure",
+	exitScrollGap:            "scroll gap",
+}
+
+var scrapeExitCodes = map[scrape.Kind]int{
+	scrape.CaptureFailure:       exitCaptureFailure,
+	scrape.FontMismatch:         exitFontMismatch,
+	scrape.SchemaViolation:      exitSchemaViolation,
+	scrape.UserAbort:            exitUserAbort,
+	scrape.VerificationMismatch: exitVerificationMismatch,
+	scrape.OutputFailure:        exitOutputFailure,
+	scrape.CheckpointNotFound:   exitResumeFailure,
+	scrape.ScrollGap:            exitScrollGap,
+}
+
+// runError is an error that stops the extractor outside the scrape, with the exit code it stops it with.
+type runError struct {
+	code int
+	err  error
+}
+
+func (e *runError) Error() string { return e.err.Error() }
+
+func (e *runError) Unwrap() error { return e.err }
+
+// stopWith returns err as an error that stops the run with exit code code.
+func stopWith(code int, err error) error {
+	return &runError{code: code, err: err}
+}
+
+// exitCode returns the exit code of a run stopped by err, exitOK for nil.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var re *runError
+	if errors.As(err, &re) {
+		return re.code
+	}
+	var se *scrape.Error
+	if errors.As(err, &se) {
+		if code, ok := scrapeExitCodes[se.Kind]; ok {
+			return code
+		}
+	}
+	return exitFailed
+}
+
+// extraction is what a run of the extractor has got to, for exit to tidy up after.
+type extraction struct {
+	command string // the subcommand run, "" for a live run
+	start   time.Time
+
+	mouseSaved     bool // whether mouseX, mouseY are where to put the mouse back
+	mouseX, mouseY int
+
+	stream  *output.Stream // the rows confirmed so far, nil before it is created and once it is closed
+	unknown *recognizer.UnknownGlyphs
+	rows    int            // in the extracted file
+	events  *events.Writer // nil without -events
+}
+
+// exit tidies up after a run stopped by err, nil once it has completed, and returns its exit code.
+func (x *extraction) exit(err error) int {
+	code := exitCode(err)
+	if x.command != "" {
+		if err != nil {
+			log.Printf("%v : %v", x.command, err)
+		}
+		return code
+	}
+
+	if err != nil {
+		log.Println(err)
+		var se *scrape.Error
+		if errors.As(err, &se) && se.Image != nil {
+			log.Printf("Saving problem image to : error_image.png")
+			saveLinesToPNG(se.Image, 0, 0, topWidth, topHeight, "error_image.png")
+		}
+	}
+
+	complete := events.Event{Event: events.Complete, Rows: x.rows, ExitCode: code}
+	if err != nil {
+		complete.Error = err.Error()
+	}
+
+	if x.stream != nil {
+		complete.Rows = x.stream.Rows()
+		// the rows so far, and the checkpoint they got to, are kept for '-resume'
+		if cerr := x.stream.Close(false, err.Error()); cerr != nil {
+			log.Printf("Error closing %v : %v", x.stream.FileName(), cerr)
+		} else {
+			log.Printf("%v rows kept in %v, carry on from here with : -resume", x.stream.Rows(), x.stream.FileName())
+		}
+	}
+	flushUnknownGlyphs(x.unknown)
+
+	if x.mouseSaved {
+		robotgo.MoveMouse(x.mouseX, x.mouseY)
+	}
+
+	log.Printf("")
+	log.Println(fmt.Sprintf("extracting TEXT took %s", time.Since(x.start)))
+	if err != nil {
+		log.Printf("Stopped by a %v, exit code %v", exitNames[code], code)
+	} else {
+		log.Printf("Capture and Conversion completed OK, %v rows", x.rows)
+	}
+
+	x.events.Emit(complete)
+	if err := x.events.Close(); err != nil {
+		log.Println(err)
+	}
+	return code
+}
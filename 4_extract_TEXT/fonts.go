@@ -0,0 +1,211 @@
+package main
+
+// Font maintenance commands, e.g. learning the glyph search order from the character counts of earlier runs.
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+const (
+	fontDescriptionFile = "optimised_character_info.json"
+	characterStatsFile  = "character_stats.json" // totals from runs with 'GatherCharacterCounts' set to 1
+)
+
+func fontsUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s fonts optimise [flags]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s fonts label [flags] [name=character ...]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  optimise  re-order the font description into the most frequent first order\n")
+	fmt.Fprintf(os.Stderr, "            of the characters counted in the stats file\n")
+	fmt.Fprintf(os.Stderr, "  label     add unknown glyphs saved by a run with 'UnknownGlyphsDir' set to the\n")
+	fmt.Fprintf(os.Stderr, "            font description, asking for the character of each one in turn unless\n")
+	fmt.Fprintf(os.Stderr, "            they are given as arguments\n")
+}
+
+// runFonts is the 'fonts' command.
+func runFonts(args []string) error {
+	if len(args) > 0 && args[0] == "label" {
+		return runFontsLabel(args[1:])
+	}
+	if len(args) == 0 || (args[0] != "optimise" && args[0] != "optimize") {
+		fontsUsage()
+		return errors.New("unknown fonts command")
+	}
+
+	fs := flag.NewFlagSet("fonts optimise", flag.ExitOnError)
+	statsPath := fs.String("stats", characterStatsFile, "character stats file")
+	fontsPath := fs.String("fonts", fontDescriptionFile, "font description file to re-order")
+	dryRun := fs.Bool("n", false, "only show the new order, do not change the font description file")
+	fs.Parse(args[1:])
+
+	stats, err := recognizer.LoadCharacterStats(*statsPath)
+	if err != nil {
+		return err
+	}
+	if len(stats.Counts) == 0 {
+		return fmt.Errorf("no character counts in %v, do a run with 'GatherCharacterCounts' set to 1 first", *statsPath)
+	}
+
+	fonts, err := recognizer.LoadFontSet(*fontsPath, fontSourceDir())
+	if err != nil {
+		return err
+	}
+	oldOrder := fonts.SearchOrder
+	if oldOrder == nil {
+		oldOrder = extractionList
+	}
+	logCharacterStats(stats, oldOrder)
+
+	if *dryRun {
+		return nil
+	}
+	if err = recognizer.RecordSearchOrder(*fontsPath, stats.Order()); err != nil {
+		return err
+	}
+	log.Printf("Search order saved in %v", *fontsPath)
+	return nil
+}
+
+// saveCharacterStats adds the counts of this run to the stats file, with the order they
+// give, for 'fonts optimise' to record in the font description file.
+func saveCharacterStats(counts [256]uint64, oldOrder []byte) error {
+	stats, err := recognizer.LoadCharacterStats(characterStatsFile)
+	if err != nil {
+		return err
+	}
+	stats.Add(counts)
+	if err = stats.Save(characterStatsFile); err != nil {
+		return err
+	}
+	logCharacterStats(stats, oldOrder)
+
+	log.Printf("Character counts saved in %v, do 'fonts optimise' to search in the new order", characterStatsFile)
+	return nil
+}
+
+// logCharacterStats shows the distribution of characters, and the search order it gives.
+func logCharacterStats(stats *recognizer.CharacterStats, oldOrder []byte) {
+	newOrder := stats.Order()
+	log.Printf("Character counts from %v run(s)", stats.Runs)
+	for _, c := range newOrder {
+		log.Printf("Character: %c  : %v", c, stats.Counts[string(c)])
+	}
+
+	var newString string = "New "
+	for _, c := range newOrder {
+		newString += " "
+		newString += string(c)
+	}
+	log.Print(newString)
+	var oldString string = "Old "
+	for _, c := range oldOrder {
+		oldString += " "
+		oldString += string(c)
+	}
+	log.Print(oldString)
+}
+
+// runFontsLabel is the 'fonts label' command.
+func runFontsLabel(args []string) error {
+	fs := flag.NewFlagSet("fonts label", flag.ExitOnError)
+	dir := fs.String("dir", "unknown_glyphs", "directory of unknown glyphs, as set by 'UnknownGlyphsDir' in the config file")
+	fontsPath := fs.String("fonts", fontDescriptionFile, "font description file to add the characters to")
+	fs.Parse(args)
+
+	glyphs, err := recognizer.ReadUnknownGlyphs(*dir)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		// labels given as name=character, e.g. from an earlier look at the .png files
+		byName := make(map[string]*recognizer.UnknownGlyph)
+		for _, u := range glyphs {
+			byName[u.Name] = u
+		}
+		for _, arg := range fs.Args() {
+			i := strings.LastIndex(arg, "=")
+			if i < 0 || len(arg)-i != 2 {
+				return fmt.Errorf("%q is not name=character", arg)
+			}
+			u, ok := byName[arg[:i]]
+			if !ok {
+				return fmt.Errorf("no unknown glyph %q in %v", arg[:i], *dir)
+			}
+			if err = labelGlyph(*dir, u, arg[i+1], *fontsPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	input := bufio.NewScanner(os.Stdin)
+	for _, u := range glyphs {
+		if u.Label != "" {
+			continue
+		}
+		fmt.Printf("\n%v  (%vx%v, seen %v times)\n", filepath.Join(*dir, u.PNGFile()), u.Width, u.Height, u.Count)
+		if u.Face != "" {
+			fmt.Printf("    face : %v\n", u.Face)
+		}
+		if img, err := readPNG(filepath.Join(*dir, u.PNGFile())); err == nil {
+			printGlyph(img)
+		}
+		for _, context := range u.Contexts {
+			fmt.Printf("    in : %v\n", context)
+		}
+		fmt.Printf("Character (Enter to skip, '/q' to quit) : ")
+		if !input.Scan() {
+			break
+		}
+		answer := input.Text()
+		if answer == "/q" {
+			break
+		}
+		if answer == "" {
+			continue
+		}
+		if len(answer) != 1 {
+			fmt.Printf("Only ONE character can be given, skipped\n")
+			continue
+		}
+		if err = labelGlyph(*dir, u, answer[0], *fontsPath); err != nil {
+			return err
+		}
+	}
+	return input.Err()
+}
+
+func labelGlyph(dir string, u *recognizer.UnknownGlyph, character byte, fontsPath string) error {
+	if err := recognizer.LabelUnknownGlyph(dir, u, character, fontsPath, fontSourceDir()); err != nil {
+		return err
+	}
+	log.Printf("Added '%c' from %v to %v", character, u.PNGFile(), fontsPath)
+	return nil
+}
+
+// printGlyph shows img in the terminal, with '#' for each pixel that is not the colour of the top left corner.
+func printGlyph(img image.Image) {
+	bounds := img.Bounds()
+	background := img.At(bounds.Min.X, bounds.Min.Y)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		line := "    "
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if img.At(x, y) == background {
+				line += "."
+			} else {
+				line += "#"
+			}
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+// Offline OCR : convert previously saved screenshots (.png) into text without a live X display.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/output"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+func ocrUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ocr [flags] file.png ...\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Each .png is either lines saved by this tool (e.g. error_image.png), or a\n")
+		fmt.Fprintf(fs.Output(), "screenshot containing the scroll window (e.g. saveCapture.png).\n\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runOCR is the 'ocr' command, it applies the same line geometry and conversion as
+// a live scrape to each of the given .png files.
+func runOCR(args []string) error {
+	fs := flag.NewFlagSet("ocr", flag.ExitOnError)
+	outPath := fs.String("out", "", "file to write the text to, '-' for stdout (default extracted_text with the extension of the format)")
+	formatFlag := fs.String("format", "", "output format, one of "+strings.Join(output.Formats, ", ")+" (default 'OutputFormat' of the config file)")
+	reverse := fs.Bool("reverse", false, "put the lines in chronological order, as a live scrape does")
+	configPath := fs.String("config", "./configuration/config.json", "path to config file")
+	showFaces := fs.Bool("faces", false, "log which face of the font set each character of each line was found in")
+	unknownDir := fs.String("unknown", "", "directory to save pixels no character matched in (default 'UnknownGlyphsDir' of the config file)")
+	profileFlag := fs.String("profile", "", "geometry profile of the window in the screenshots (default 'ProfileFile' of the config file)")
+	fs.Usage = ocrUsage(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no .png files given")
+	}
+
+	fonts, err := loadFontBitmaps()
+	if err != nil {
+		return err
+	}
+	config, _ := getConfig(*configPath)
+	if *formatFlag != "" {
+		config.OutputFormat = *formatFlag
+	}
+	if *outPath == "" {
+		*outPath = extractedFileName(config.OutputFormat)
+	}
+	if *unknownDir != "" {
+		config.UnknownGlyphsDir = *unknownDir
+	}
+	if *profileFlag != "" {
+		config.ProfileFile = *profileFlag
+	}
+	if err = useProfile(config.ProfileFile); err != nil {
+		return err
+	}
+	options, err := recognizerOptions(config)
+	if err != nil {
+		return err
+	}
+	options.GatherCharacterCounts = false
+	rec, err := recognizer.New(fonts, options)
+	if err != nil {
+		return err
+	}
+	if _, err = output.New(config.OutputFormat, ioutil.Discard, rec.Schema()); err != nil {
+		return err
+	}
+
+	var lines []recognizer.Row
+	var nofErrors int
+
+	for _, fileName := range fs.Args() {
+		img, err := readPNG(fileName)
+		if err != nil {
+			return err
+		}
+
+		lineRects, err := findLines(img)
+		if err != nil {
+			return fmt.Errorf("%v : %v", fileName, err)
+		}
+		log.Printf("%v : %v lines", fileName, len(lineRects))
+
+		for lineNum, rect := range lineRects {
+			if *showFaces {
+				matches, err := rec.MatchesImage(img, rect)
+				if err == nil {
+					log.Printf("%v line %v faces : %v", fileName, lineNum, faceRuns(matches))
+				}
+			}
+			row, err := rec.RowImage(img, rect)
+			if err != nil {
+				log.Printf("%v line %v : %v", fileName, lineNum, err)
+				nofErrors++
+				continue
+			}
+			lines = append(lines, row)
+		}
+	}
+
+	flushUnknownGlyphs(options.Unknown)
+
+	if *reverse {
+		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+			lines[i], lines[j] = lines[j], lines[i]
+		}
+	}
+
+	if *outPath == "-" {
+		if err := writeRowsTo(os.Stdout, lines, config.OutputFormat, rec.Schema()); err != nil {
+			return err
+		}
+	} else if err := writeRows(lines, *outPath, config.OutputFormat, rec.Schema()); err != nil {
+		return err
+	}
+
+	if nofErrors > 0 {
+		return fmt.Errorf("%v line(s) could not be converted", nofErrors)
+	}
+	return nil
+}
+
+// faceRuns describes the characters of a line a face at a time, e.g. bold "Time" regular "12:00:01".
+func faceRuns(matches []recognizer.Match) string {
+	var runs []string
+	var text []byte
+	for i, m := range matches {
+		text = append(text, m.Character)
+		if i == len(matches)-1 || matches[i+1].Face != m.Face {
+			name := m.Face
+			if name == "" {
+				name = "(unnamed)"
+			}
+			runs = append(runs, fmt.Sprintf("%s %q", name, text))
+			text = text[:0]
+		}
+	}
+	return strings.Join(runs, " ")
+}
+
+func readPNG(fileName string) (image.Image, error) {
+	infile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+
+	img, err := png.Decode(infile)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode .png file %v : %v", fileName, err)
+	}
+	return img, nil
+}
+
+// findLines works out where the text lines are in img.
+// An image exactly 'topWidth' wide and a multiple of 'topHeight' high is taken to be lines
+// saved by saveLinesToPNG(), otherwise img must contain the scroll window, which is located
+// by searching for the profile's anchor image the same way a live scrape does.
+func findLines(img image.Image) ([]image.Rectangle, error) {
+	bounds := img.Bounds()
+	var topX, topY, nofLines int
+
+	if bounds.Dx() == topWidth && bounds.Dy()%topHeight == 0 {
+		topX = bounds.Min.X
+		topY = bounds.Min.Y
+		nofLines = bounds.Dy() / topHeight
+	} else {
+		anchor, err := readPNG(profile.Anchor)
+		if err != nil {
+			return nil, err
+		}
+		anchorX, anchorY, ok := findImage(img, anchor)
+		if !ok {
+			return nil, errors.New("can not find the scroll window, searched for " + profile.Anchor)
+		}
+		topX, topY = point{X: profile.TextArea.X, Y: profile.TextArea.Y}.at(anchorX, anchorY)
+		nofLines = linesShown
+	}
+
+	var lineRects []image.Rectangle
+	for lineNum := 0; lineNum < nofLines; lineNum++ {
+		rect := image.Rect(topX, topY+lineNum*topHeight, topX+topWidth, topY+(lineNum+1)*topHeight)
+		if !rect.In(bounds) {
+			return nil, fmt.Errorf("line %v at %v is outside of the image", lineNum, rect)
+		}
+		lineRects = append(lineRects, rect)
+	}
+	return lineRects, nil
+}
+
+// toRGB returns the pixels of img as 0x00RRGGBB values, a row at a time.
+func toRGB(img image.Image) []uint32 {
+	bounds := img.Bounds()
+	pixels := make([]uint32, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, (r>>8)<<16|(g>>8)<<8|(b>>8))
+		}
+	}
+	return pixels
+}
+
+// findImage returns the position of the first exact match of find within img.
+func findImage(img image.Image, find image.Image) (int, int, bool) {
+	imgW, imgH := img.Bounds().Dx(), img.Bounds().Dy()
+	findW, findH := find.Bounds().Dx(), find.Bounds().Dy()
+	if findW > imgW || findH > imgH || findW == 0 || findH == 0 {
+		return 0, 0, false
+	}
+
+	imgPix := toRGB(img)
+	findPix := toRGB(find)
+
+	for y := 0; y <= imgH-findH; y++ {
+		for x := 0; x <= imgW-findW; x++ {
+			if imgPix[y*imgW+x] != findPix[0] {
+				continue
+			}
+			for fy := 0; fy < findH; fy++ {
+				row := (y+fy)*imgW + x
+				for fx := 0; fx < findW; fx++ {
+					if imgPix[row+fx] != findPix[fy*findW+fx] {
+						goto notSame
+					}
+				}
+			}
+			return img.Bounds().Min.X + x, img.Bounds().Min.Y + y, true
+		notSame:
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// testdata/mock_top.png is the top of 3_scroll_window_Mock showing the first 4 lines of the mock data, with
+// testdata/mock_top.json its profile.
+var mockTopLines = []string{
+	"00:00:00,1,4,20,1",
+	"00:00:00,2,7,4,1",
+	"00:00:00,3,7,14,1",
+	"00:00:00,4,7,3,1",
+}
+
+func TestOCR(t *testing.T) {
+	if err := useProfile("testdata/mock_top.json"); err != nil {
+		t.Fatal(err)
+	}
+	fonts, err := loadFontBitmaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := recognizer.New(fonts, recognizer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	screenshot, err := readPNG("testdata/mock_top.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lines as saved by saveLinesToPNG, e.g. error_image.png
+	lines := image.NewRGBA(image.Rect(0, 0, topWidth, topHeight*len(mockTopLines)))
+	draw.Draw(lines, lines.Bounds(), screenshot, image.Pt(1, 63), draw.Src)
+
+	for name, img := range map[string]image.Image{"screenshot": screenshot, "lines": lines} {
+		lineRects, err := findLines(img)
+		if err != nil {
+			t.Fatalf("%v : %v", name, err)
+		}
+		if len(lineRects) != len(mockTopLines) {
+			t.Fatalf("%v : found %v lines, want %v", name, len(lineRects), len(mockTopLines))
+		}
+		for lineNum, rect := range lineRects {
+			row, err := rec.RowImage(img, rect)
+			if err != nil {
+				t.Fatalf("%v line %v : %v", name, lineNum, err)
+			}
+			if row.Text != mockTopLines[lineNum] {
+				t.Errorf("%v line %v : got %q, want %q", name, lineNum, row.Text, mockTopLines[lineNum])
+			}
+		}
+	}
+}
+
+func TestFindImage(t *testing.T) {
+	screenshot, err := readPNG("testdata/mock_top.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor, err := readPNG("scroll_mock.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, ok := findImage(screenshot, anchor); !ok || x != 190 || y != 3 {
+		t.Fatalf("found the anchor at %v, %v (%v), want 190, 3", x, y, ok)
+	}
+	if _, _, ok := findImage(anchor, screenshot); ok {
+		t.Fatal("found the screenshot in the anchor")
+	}
+}
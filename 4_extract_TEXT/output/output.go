@@ -0,0 +1,213 @@
+// Package output writes the rows converted by the recognizer in the formats that
+// downstream tools read: the plain delimited text the extractor has always written,
+// CSV with a header row, JSON Lines with typed values, or TSV.
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// Output formats.
+const (
+	FormatText  = "text"  // the fields joined by the schema's Delimiter, no header
+	FormatCSV   = "csv"   // RFC 4180 CSV, with a header row of the field names
+	FormatJSONL = "jsonl" // one JSON object per row, numbers as numbers
+	FormatTSV   = "tsv"   // tab separated, with a header row of the field names
+)
+
+// Formats lists the output formats, for usage messages.
+var Formats = []string{FormatText, FormatCSV, FormatJSONL, FormatTSV}
+
+// Writer writes converted rows.
+type Writer interface {
+	// WriteRow writes the fields of one row, as returned in recognizer.Row.Fields.
+	WriteRow(fields []string) error
+	// Flush writes any buffered data to the underlying io.Writer.
+	Flush() error
+}
+
+// New returns a Writer of format to w, for rows laid out by schema.
+// Formats with a header row write it straight away.
+func New(format string, w io.Writer, schema *recognizer.Schema) (Writer, error) {
+	return newWriter(format, w, schema, true)
+}
+
+func newWriter(format string, w io.Writer, schema *recognizer.Schema, header bool) (Writer, error) {
+	switch format {
+	case FormatText, "":
+		return &textWriter{w: bufio.NewWriter(w), delimiter: schema.Delimiter}, nil
+	case FormatCSV:
+		cw := &csvWriter{w: csv.NewWriter(w)}
+		if !header {
+			return cw, nil
+		}
+		return cw, cw.w.Write(fieldNames(schema))
+	case FormatJSONL:
+		return newJSONLWriter(w, schema), nil
+	case FormatTSV:
+		tw := &tsvWriter{textWriter{w: bufio.NewWriter(w), delimiter: "\t"}}
+		if !header {
+			return tw, nil
+		}
+		return tw, tw.WriteRow(fieldNames(schema))
+	}
+	return nil, fmt.Errorf("output format %q is not one of %v", format, strings.Join(Formats, ", "))
+}
+
+// Extension is the usual file name extension of format, including the '.'.
+func Extension(format string) string {
+	switch format {
+	case FormatJSONL:
+		return ".jsonl"
+	case FormatTSV:
+		return ".tsv"
+	}
+	return ".csv"
+}
+
+func fieldNames(schema *recognizer.Schema) []string {
+	names := make([]string, len(schema.Fields))
+	for i, f := range schema.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+type textWriter struct {
+	w         *bufio.Writer
+	delimiter string
+}
+
+func (t *textWriter) WriteRow(fields []string) error {
+	for i, field := range fields {
+		if i > 0 {
+			t.w.WriteString(t.delimiter)
+		}
+		t.w.WriteString(field)
+	}
+	return t.w.WriteByte('\n')
+}
+
+func (t *textWriter) Flush() error {
+	return t.w.Flush()
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) WriteRow(fields []string) error {
+	return c.w.Write(fields)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// tsvWriter is a textWriter that keeps tabs and line breaks within fields from splitting them.
+type tsvWriter struct {
+	textWriter
+}
+
+var tsvReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func (t *tsvWriter) WriteRow(fields []string) error {
+	clean := make([]string, len(fields))
+	for i, field := range fields {
+		clean[i] = tsvReplacer.Replace(field)
+	}
+	return t.textWriter.WriteRow(clean)
+}
+
+type jsonlWriter struct {
+	w     *bufio.Writer
+	keys  [][]byte // the JSON encoded field names
+	types []string
+}
+
+func newJSONLWriter(w io.Writer, schema *recognizer.Schema) *jsonlWriter {
+	j := &jsonlWriter{w: bufio.NewWriter(w)}
+	for _, f := range schema.Fields {
+		key, _ := json.Marshal(f.Name)
+		j.keys = append(j.keys, key)
+		j.types = append(j.types, f.Type)
+	}
+	return j
+}
+
+// WriteRow writes the fields as one JSON object, in schema order. Fields of type
+// int, decimal and percent (without its '%') are numbers, any other is a string.
+func (j *jsonlWriter) WriteRow(fields []string) error {
+	if len(fields) != len(j.keys) {
+		return fmt.Errorf("row has %v fields, the schema has %v", len(fields), len(j.keys))
+	}
+	j.w.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		j.w.Write(j.keys[i])
+		j.w.WriteByte(':')
+		if number, ok := jsonNumber(field, j.types[i]); ok {
+			j.w.WriteString(number)
+		} else {
+			value, err := json.Marshal(field)
+			if err != nil {
+				return err
+			}
+			j.w.Write(value)
+		}
+	}
+	_, err := j.w.WriteString("}\n") // the bufio.Writer keeps the first error writing the row
+	return err
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
+
+var jsonDigits = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// jsonNumber returns field as a JSON number, if its type is a number and it is one.
+func jsonNumber(field string, fieldType string) (string, bool) {
+	switch fieldType {
+	case recognizer.FieldInt:
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return "", false
+		}
+		return strconv.FormatInt(n, 10), true
+	case recognizer.FieldPercent:
+		field = strings.TrimSuffix(field, "%")
+		fallthrough
+	case recognizer.FieldDecimal:
+		// keep the digits as they are, but in the form JSON allows: no '+', no bare '.'
+		field = strings.TrimPrefix(field, "+")
+		sign := ""
+		if strings.HasPrefix(field, "-") {
+			sign, field = "-", field[1:]
+		}
+		field = strings.TrimSuffix(field, ".")
+		if strings.HasPrefix(field, ".") {
+			field = "0" + field
+		}
+		for len(field) > 1 && field[0] == '0' && field[1] != '.' {
+			field = field[1:]
+		}
+		if !jsonDigits.MatchString(field) {
+			return "", false
+		}
+		return sign + field, true
+	}
+	return "", false
+}
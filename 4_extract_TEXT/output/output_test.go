@@ -0,0 +1,152 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// testSchema has a field of each type. The writers only use the names and types of its fields.
+var testSchema = &recognizer.Schema{
+	Separators: "|",
+	Delimiter:  ",",
+	Fields: []recognizer.Field{
+		{Name: "Time", Type: recognizer.FieldTime},
+		{Name: "Count", Type: recognizer.FieldInt},
+		{Name: "Value", Type: recognizer.FieldDecimal},
+		{Name: "Share", Type: recognizer.FieldPercent},
+		{Name: "Note", Type: recognizer.FieldText},
+	},
+}
+
+func TestWriters(t *testing.T) {
+	rows := [][]string{
+		{"00:00:01", "12", "1.5", "50%", "plain"},
+		{"00:00:02", "-007", "+.5", "12.50%", "a,b"},
+		{"00:00:03", "x", "1.2.3", "%", `say "hi"`},
+		{"00:00:04", "+3", "-1.", "-0.5%", "tab\there"},
+		{"00:00:05", "0", "007.250", "100%", "two\nlines"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatText, "" + // the fields as they are, joined by the Delimiter, as always
+			"00:00:01,12,1.5,50%,plain\n" +
+			"00:00:02,-007,+.5,12.50%,a,b\n" +
+			"00:00:03,x,1.2.3,%,say \"hi\"\n" +
+			"00:00:04,+3,-1.,-0.5%,tab\there\n" +
+			"00:00:05,0,007.250,100%,two\nlines\n"},
+		{FormatCSV, "" +
+			"Time,Count,Value,Share,Note\n" +
+			"00:00:01,12,1.5,50%,plain\n" +
+			"00:00:02,-007,+.5,12.50%,\"a,b\"\n" +
+			"00:00:03,x,1.2.3,%,\"say \"\"hi\"\"\"\n" +
+			"00:00:04,+3,-1.,-0.5%,tab\there\n" +
+			"00:00:05,0,007.250,100%,\"two\nlines\"\n"},
+		{FormatTSV, "" + // tabs and line breaks in a field become spaces
+			"Time\tCount\tValue\tShare\tNote\n" +
+			"00:00:01\t12\t1.5\t50%\tplain\n" +
+			"00:00:02\t-007\t+.5\t12.50%\ta,b\n" +
+			"00:00:03\tx\t1.2.3\t%\tsay \"hi\"\n" +
+			"00:00:04\t+3\t-1.\t-0.5%\ttab here\n" +
+			"00:00:05\t0\t007.250\t100%\ttwo lines\n"},
+		{FormatJSONL, "" + // numbers as JSON numbers, anything that is not one as a string
+			`{"Time":"00:00:01","Count":12,"Value":1.5,"Share":50,"Note":"plain"}` + "\n" +
+			`{"Time":"00:00:02","Count":-7,"Value":0.5,"Share":12.50,"Note":"a,b"}` + "\n" +
+			`{"Time":"00:00:03","Count":"x","Value":"1.2.3","Share":"%","Note":"say \"hi\""}` + "\n" +
+			`{"Time":"00:00:04","Count":3,"Value":-1,"Share":-0.5,"Note":"tab\there"}` + "\n" +
+			`{"Time":"00:00:05","Count":0,"Value":7.250,"Share":100,"Note":"two\nlines"}` + "\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		w, err := New(test.format, &out, testSchema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err = w.WriteRow(row); err != nil {
+				t.Fatalf("%v : %v", test.format, err)
+			}
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.want {
+			t.Errorf("%v : got\n%s\nwant\n%s", test.format, out.String(), test.want)
+		}
+	}
+
+	if _, err := New("xml", &bytes.Buffer{}, testSchema); err == nil {
+		t.Errorf("no error for an unknown format")
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	tests := []struct {
+		field, fieldType string
+		want             string // "" for not a number
+	}{
+		{"12", recognizer.FieldInt, "12"},
+		{"+12", recognizer.FieldInt, "12"},
+		{"-0", recognizer.FieldInt, "0"},
+		{"1.0", recognizer.FieldInt, ""},
+		{"99999999999999999999", recognizer.FieldInt, ""},
+		{"1.50", recognizer.FieldDecimal, "1.50"}, // the digits are kept as they are
+		{"-.5", recognizer.FieldDecimal, "-0.5"},
+		{"00.5", recognizer.FieldDecimal, "0.5"},
+		{"5.", recognizer.FieldDecimal, "5"},
+		{".", recognizer.FieldDecimal, ""},
+		{"1e3", recognizer.FieldDecimal, ""},
+		{"", recognizer.FieldDecimal, ""},
+		{"7.5%", recognizer.FieldPercent, "7.5"},
+		{"7.5", recognizer.FieldPercent, "7.5"},
+		{"12", recognizer.FieldText, ""},
+		{"12", recognizer.FieldTime, ""},
+		{"12", "", ""},
+	}
+	for _, test := range tests {
+		got, ok := jsonNumber(test.field, test.fieldType)
+		if ok != (test.want != "") || got != test.want {
+			t.Errorf("%q of type %q : got %q, %v, want %q", test.field, test.fieldType, got, ok, test.want)
+		}
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+var errWrite = errors.New("disk full")
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errWrite }
+
+func TestWriteErrors(t *testing.T) {
+	row := []string{"00:00:01", "12", "1.5", "50%", "a row long enough to fill the buffer of the writer soon"}
+	for _, format := range Formats {
+		w, err := newWriter(format, failingWriter{}, testSchema, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the rows are buffered, so the error is returned by the row that fills the buffer
+		for i := 0; i < 1000 && err == nil; i++ {
+			err = w.WriteRow(row)
+		}
+		if !errors.Is(err, errWrite) {
+			t.Errorf("%v : WriteRow got %v, want the error of the write", format, err)
+		}
+		if err = w.Flush(); !errors.Is(err, errWrite) {
+			t.Errorf("%v : Flush got %v, want the error of the write", format, err)
+		}
+	}
+
+	w, err := New(FormatJSONL, &bytes.Buffer{}, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRow(row[:4]); err == nil {
+		t.Errorf("jsonl : no error for a row with too few fields")
+	}
+}
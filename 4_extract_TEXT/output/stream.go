@@ -0,0 +1,312 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/atomicfile"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// StreamStatus is kept in a sidecar file next to a stream, see StatusFile.
+// A run that stopped before Stream.Close leaves Complete false.
+type StreamStatus struct {
+	Format   string    // the output format of the stream
+	Rows     int       // rows written by the last update of the status
+	Complete bool      // true once the run has scraped all the rows
+	Reason   string    `json:",omitempty"` // why the run stopped, if it did not complete
+	Started  time.Time // when the stream was created
+	Updated  time.Time // when the rows were last synced to disk
+
+	// Checkpoint is whatever the scraper needs to carry on from the last row synced, see Stream.SetCheckpoint.
+	Checkpoint json.RawMessage `json:",omitempty"`
+}
+
+// StatusFile is the name of the sidecar file holding the StreamStatus of the stream streamFile.
+func StatusFile(streamFile string) string {
+	return streamFile + ".status"
+}
+
+// ReadStreamStatus reads the status saved next to the stream streamFile.
+func ReadStreamStatus(streamFile string) (*StreamStatus, error) {
+	data, err := ioutil.ReadFile(StatusFile(streamFile))
+	if err != nil {
+		return nil, err
+	}
+	status := &StreamStatus{}
+	if err = json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("stream status %v : %v", StatusFile(streamFile), err)
+	}
+	return status, nil
+}
+
+// Stream appends rows to a file as they are scraped, so that a run that stops part way
+// (an error, a user exit or a crash) keeps every row written before it stopped.
+// The rows are handed to the operating system after each Write, and synced to disk,
+// with the status sidecar brought up to date, at most every sync interval.
+type Stream struct {
+	fileName     string
+	file         *os.File
+	w            Writer
+	status       StreamStatus
+	syncInterval time.Duration
+	lastSync     time.Time
+	checkpoint   interface{}
+}
+
+// CreateStream creates (or truncates) fileName for rows of format laid out by schema, and
+// its status sidecar, marked as not complete. A syncInterval of 0 syncs on every Write.
+func CreateStream(fileName string, format string, schema *recognizer.Schema, syncInterval time.Duration) (*Stream, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := New(format, file, schema)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	now := time.Now()
+	s := &Stream{
+		fileName:     fileName,
+		file:         file,
+		w:            w,
+		status:       StreamStatus{Format: format, Started: now},
+		syncInterval: syncInterval,
+	}
+	if err = s.Sync(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ResumeStream opens the stream fileName left by a run that did not complete, to carry on
+// writing to it. Any rows written after its status was last updated are cut off, so that
+// the stream holds exactly the rows counted by the status returned, and its checkpoint.
+func ResumeStream(fileName string, schema *recognizer.Schema, syncInterval time.Duration) (*Stream, *StreamStatus, error) {
+	status, err := ReadStreamStatus(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status.Complete {
+		return nil, nil, fmt.Errorf("the run that wrote %v completed, there is nothing to resume", fileName)
+	}
+
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the writer is made first, so that a status of an unknown format does not cut the stream short
+	w, err := newWriter(status.Format, file, schema, false)
+	var size int64
+	if err == nil {
+		size, err = lineOffset(file, HeaderLines(status.Format)+status.Rows)
+	}
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("resuming %v : %v", fileName, err)
+	}
+
+	s := &Stream{
+		fileName:     fileName,
+		file:         file,
+		w:            w,
+		status:       *status,
+		syncInterval: syncInterval,
+	}
+	s.status.Reason = ""
+	if err = s.Sync(); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return s, status, nil
+}
+
+// lineOffset returns the offset of the start of line n (counting from 0) of file.
+func lineOffset(file *os.File, n int) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(file)
+	var offset int64
+	for i := 0; i < n; i++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return 0, fmt.Errorf("only %v of the %v lines counted by its status", i, n)
+		}
+		offset += int64(len(line))
+	}
+	return offset, nil
+}
+
+// FileName is the name of the stream's file.
+func (s *Stream) FileName() string { return s.fileName }
+
+// Rows is the number of rows written so far.
+func (s *Stream) Rows() int { return s.status.Rows }
+
+// SetCheckpoint sets what is saved as the Checkpoint of the status when the stream is next synced.
+// Set it before the Write of the rows it follows, so that the status always counts
+// the rows that were written before the checkpoint it holds.
+func (s *Stream) SetCheckpoint(checkpoint interface{}) {
+	s.checkpoint = checkpoint
+}
+
+// Write appends rows to the stream.
+func (s *Stream) Write(rows []recognizer.Row) error {
+	for _, row := range rows {
+		if err := s.w.WriteRow(row.Fields); err != nil {
+			return err
+		}
+		s.status.Rows++
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if time.Since(s.lastSync) >= s.syncInterval {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Sync flushes the rows written so far to disk, then updates the status sidecar to count them.
+func (s *Stream) Sync() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.lastSync = time.Now()
+	s.status.Updated = s.lastSync
+	return s.writeStatus()
+}
+
+// Close syncs and closes the stream, recording in the status sidecar whether the
+// run completed, and if not, why.
+func (s *Stream) Close(complete bool, reason string) error {
+	s.status.Complete = complete
+	s.status.Reason = reason
+	err := s.Sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *Stream) writeStatus() error {
+	if s.checkpoint != nil {
+		checkpoint, err := json.Marshal(s.checkpoint)
+		if err != nil {
+			return err
+		}
+		s.status.Checkpoint = checkpoint
+	}
+	data, err := json.MarshalIndent(&s.status, "", "    ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(StatusFile(s.fileName), append(data, '\n'))
+}
+
+// HeaderLines is the number of header lines that format starts a file with.
+func HeaderLines(format string) int {
+	switch format {
+	case FormatCSV, FormatTSV:
+		return 1
+	}
+	return 0
+}
+
+// Reverse writes the rows of streamFile, a file of format, to outFile in the opposite
+// order, keeping any header line first. The scraper finds the newest rows first, so this
+// puts a stream into chronological order. Each row is one line, as the recognizer never
+// puts line breaks in a field. The stream is read back from its end a block at a time,
+// so that one of any length is reversed without holding it all in memory.
+func Reverse(streamFile string, outFile string, format string) error {
+	file, err := os.Open(streamFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(outFile, func(w io.Writer) error {
+		out := bufio.NewWriter(w)
+		r := bufio.NewReader(file)
+		var rowsStart int64
+		for i := 0; i < HeaderLines(format); i++ {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				rowsStart += int64(len(line))
+				out.Write(line)
+			}
+			if err == io.EOF {
+				if len(line) > 0 {
+					out.WriteByte('\n') // a header cut short
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := reverseLines(out, file, rowsStart, info.Size()); err != nil {
+			return err
+		}
+		return out.Flush()
+	})
+}
+
+// reverseBlockSize is how much of a stream Reverse reads at a time.
+var reverseBlockSize int64 = 64 * 1024
+
+// reverseLines writes the lines of file from offset start to end to w, the last first. A last
+// line without a line end, as left by a run that stopped part way through writing it, is given one.
+func reverseLines(w *bufio.Writer, file io.ReaderAt, start int64, end int64) error {
+	var pending []byte // the lines of the blocks read that have not been written, without the last line end
+	pos := end
+	for pos > start {
+		n := reverseBlockSize
+		if pos-start < n {
+			n = pos - start
+		}
+		pos -= n
+		block := make([]byte, n, n+int64(len(pending)))
+		if _, err := file.ReadAt(block, pos); err != nil {
+			return err
+		}
+		if pos+n == end && block[n-1] == '\n' {
+			block = block[:n-1]
+		}
+		pending = append(block, pending...)
+
+		// every line after a line end is complete
+		for i := bytes.LastIndexByte(pending, '\n'); i >= 0; i = bytes.LastIndexByte(pending, '\n') {
+			w.Write(pending[i+1:])
+			w.WriteByte('\n')
+			pending = pending[:i]
+		}
+	}
+	if end > start {
+		w.Write(pending)
+		w.WriteByte('\n')
+	}
+	return nil // any error writing is kept by w, for its Flush
+}
@@ -0,0 +1,253 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// testRows returns n rows of testSchema, newest first as the scraper finds them.
+func testRows(n int) []recognizer.Row {
+	rows := make([]recognizer.Row, n)
+	for i := range rows {
+		seconds := n - i
+		rows[i].Fields = []string{
+			fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60),
+			fmt.Sprint(seconds), fmt.Sprintf("%v.5", i), "12%", fmt.Sprintf("note, %v", i),
+		}
+	}
+	return rows
+}
+
+// formatted is rows written as format by a Writer.
+func formatted(t *testing.T, format string, rows []recognizer.Row) string {
+	var out bytes.Buffer
+	w, err := New(format, &out, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err = w.WriteRow(row.Fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestStreamReverse(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// enough rows to be read back in several blocks
+	rows := testRows(3000)
+	chronological := make([]recognizer.Row, len(rows))
+	for i, row := range rows {
+		chronological[len(rows)-1-i] = row
+	}
+
+	for _, format := range Formats {
+		streamFile := filepath.Join(dir, "stream"+Extension(format))
+		outFile := filepath.Join(dir, "out"+Extension(format))
+
+		s, err := CreateStream(streamFile, format, testSchema, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(rows); i += 70 {
+			end := i + 70
+			if end > len(rows) {
+				end = len(rows)
+			}
+			if err = s.Write(rows[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = s.Close(true, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		status, err := ReadStreamStatus(streamFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Complete || status.Rows != len(rows) || status.Format != format {
+			t.Errorf("%v : status %+v, want %v rows complete", format, status, len(rows))
+		}
+		if got, _ := ioutil.ReadFile(streamFile); string(got) != formatted(t, format, rows) {
+			t.Errorf("%v : the stream is not the rows as written", format)
+		}
+
+		if err = Reverse(streamFile, outFile, format); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadFile(outFile); string(got) != formatted(t, format, chronological) {
+			t.Errorf("%v : the reversed stream is not the rows in chronological order", format)
+		}
+	}
+}
+
+func TestReverseLines(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func(size int64) { reverseBlockSize = size }(reverseBlockSize)
+
+	tests := []struct {
+		format string
+		stream string
+		want   string
+	}{
+		{FormatText, "", ""},
+		{FormatText, "a\n", "a\n"},
+		{FormatText, "a\nbb\nccc\n", "ccc\nbb\na\n"},
+		{FormatText, "a\n\nccc\n", "ccc\n\na\n"},          // an empty line is kept
+		{FormatText, "a\nbb\ncc", "cc\nbb\na\n"},          // a torn last line is given a line end
+		{FormatCSV, "H,I\n", "H,I\n"},                     // only the header
+		{FormatCSV, "H,I", "H,I\n"},                       // a torn header
+		{FormatCSV, "H,I\n1,2\n3,4\n", "H,I\n3,4\n1,2\n"}, // the header stays first
+		{FormatTSV, "H\tI\n1\t2\n3\t4", "H\tI\n3\t4\n1\t2\n"},
+		{FormatJSONL, "{\"a\":1}\n{\"a\":22}\n", "{\"a\":22}\n{\"a\":1}\n"},
+	}
+	for _, size := range []int64{1, 2, 3, 5, 64 * 1024} {
+		reverseBlockSize = size
+		for _, test := range tests {
+			streamFile := filepath.Join(dir, "stream")
+			outFile := filepath.Join(dir, "out")
+			if err := ioutil.WriteFile(streamFile, []byte(test.stream), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := Reverse(streamFile, outFile, test.format); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := ioutil.ReadFile(outFile); string(got) != test.want {
+				t.Errorf("blocks of %v, %v %q : got %q, want %q", size, test.format, test.stream, got, test.want)
+			}
+		}
+	}
+
+	if err := Reverse(filepath.Join(dir, "missing"), filepath.Join(dir, "out"), FormatText); err == nil {
+		t.Errorf("no error reversing a missing stream")
+	}
+}
+
+func TestResumeStream(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	rows := testRows(30)
+
+	for _, format := range Formats {
+		streamFile := filepath.Join(dir, "stream"+Extension(format))
+
+		// rows 0-9 synced with their checkpoint, rows 10-19 written after the last sync, then a torn row
+		s, err := CreateStream(streamFile, format, testSchema, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetCheckpoint(map[string]int{"Page": 1})
+		if err = s.Write(rows[:10]); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		s.SetCheckpoint(map[string]int{"Page": 2})
+		if err = s.Write(rows[10:20]); err != nil {
+			t.Fatal(err)
+		}
+		s.file.WriteString("00:00:0")
+		s.file.Close() // as if the run had been killed
+
+		s, status, err := ResumeStream(streamFile, testSchema, 0)
+		if err != nil {
+			t.Fatalf("%v : %v", format, err)
+		}
+		var checkpoint struct{ Page int }
+		json.Unmarshal(status.Checkpoint, &checkpoint)
+		if status.Rows != 10 || s.Rows() != 10 || checkpoint.Page != 1 {
+			t.Errorf("%v : resumed at %v rows, checkpoint %s, want 10 and page 1", format, status.Rows, status.Checkpoint)
+		}
+		if err = s.Write(rows[20:]); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Close(true, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		want := formatted(t, format, append(append([]recognizer.Row(nil), rows[:10]...), rows[20:]...))
+		if got, _ := ioutil.ReadFile(streamFile); string(got) != want {
+			t.Errorf("%v : got\n%s\nwant\n%s", format, got, want)
+		}
+		if status, err = ReadStreamStatus(streamFile); err != nil || status.Rows != 20 || !status.Complete {
+			t.Errorf("%v : status %+v, %v, want 20 rows complete", format, status, err)
+		}
+
+		// a completed run has nothing to resume
+		if _, _, err = ResumeStream(streamFile, testSchema, 0); err == nil {
+			t.Errorf("%v : resumed a completed stream", format)
+		}
+	}
+}
+
+func TestResumeStreamErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	streamFile := filepath.Join(dir, "stream.csv")
+
+	newStream := func() {
+		s, err := CreateStream(streamFile, FormatCSV, testSchema, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Write(testRows(5)); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Close(false, "stopped"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		spoil func()
+	}{
+		{"no status file", func() { os.Remove(StatusFile(streamFile)) }},
+		{"corrupt status file", func() { ioutil.WriteFile(StatusFile(streamFile), []byte(`{"Format": "csv", "Rows": `), 0644) }},
+		{"no stream", func() { os.Remove(streamFile) }},
+		{"status counts more rows than the stream has", func() {
+			data, _ := ioutil.ReadFile(streamFile)
+			ioutil.WriteFile(streamFile, data[:len(data)-1], 0644) // the last row is torn
+		}},
+		{"unknown format", func() {
+			ioutil.WriteFile(StatusFile(streamFile), []byte(`{"Format": "xml", "Rows": 5}`), 0644)
+		}},
+	}
+	for _, test := range tests {
+		newStream()
+		test.spoil()
+		before, _ := ioutil.ReadFile(streamFile)
+		if _, _, err := ResumeStream(streamFile, testSchema, 0); err == nil {
+			t.Errorf("%v : resumed with no error", test.name)
+		}
+		// the stream is not cut short by a resume that failed
+		if after, err := ioutil.ReadFile(streamFile); err == nil && !bytes.Equal(after, before) {
+			t.Errorf("%v : the stream was changed", test.name)
+		}
+	}
+}
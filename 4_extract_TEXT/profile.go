@@ -0,0 +1,139 @@
+package main
+
+// Geometry profiles : where the text and the scroll controls of the window being scraped are,
+// so that scraping a different application needs a new profile rather than a code change.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// point is a position relative to the top left corner of the profile's anchor image, as found on screen.
+type point struct {
+	X int
+	Y int
+}
+
+// geometryProfile describes the window being scraped. All positions are relative to the top left
+// corner of where Anchor is found on screen, so the window can be anywhere.
+type geometryProfile struct {
+	Name   string
+	Anchor string // .png of part of the window that is never scrolled, e.g. its title
+
+	// AnchorInWindow is where the top left corner of Anchor is in the window, for when the window is
+	// picked with -window-id or -window-name rather than found by searching the screen for Anchor.
+	AnchorInWindow *point `json:",omitempty"`
+
+	TextArea struct {
+		X     int // left of the top line
+		Y     int // top of the top line
+		Width int
+	}
+	LinePitch    int // rows of pixels from the top of one line to the top of the next
+	LinesPerPage int // lines shown in the text area at once
+
+	Focus    point // clicked to select the window before scrolling
+	LineUp   point // clicked to scroll up a line, e.g. the up arrow of the scroll bar
+	LineDown point // clicked to scroll down a line
+	PageUp   point // clicked to scroll up a page, e.g. the top of the scroll track
+	PageDown point // 'PageDownOffset' of the config file above this is clicked to scroll down a page
+
+	// ScrollTrack, if set, is where the grip of the scroll bar moves, for estimates of the length of the
+	// document as it is scraped.
+	ScrollTrack *scrollTrack `json:",omitempty"`
+}
+
+// scrollTrack is a column of pixels down the scroll bar, in which only the grip is GripColour. It is the
+// rows that the grip is in at the top of the document down to those it is in at the end.
+type scrollTrack struct {
+	X, Y       int // top, relative to the anchor
+	Height     int
+	GripColour string // "#RRGGBB"
+}
+
+// gripColour returns the GripColour of t as 0xRRGGBB.
+func (t *scrollTrack) gripColour() (uint32, error) {
+	var r, g, b uint32
+	if n, _ := fmt.Sscanf(t.GripColour, "#%02x%02x%02x", &r, &g, &b); n != 3 {
+		return 0, fmt.Errorf("'GripColour' must be \"#RRGGBB\", NOT : %v", t.GripColour)
+	}
+	return r<<16 | g<<8 | b, nil
+}
+
+// defaultProfile is the geometry of 3_scroll_window_Mock, used when no profile file is given.
+func defaultProfile() *geometryProfile {
+	p := &geometryProfile{
+		Name:           "scroll_mock",
+		Anchor:         "scroll_mock.png",
+		AnchorInWindow: &point{X: 190, Y: 3},
+		LinePitch:      18,
+		LinesPerPage:   50,
+		Focus:          point{X: -180, Y: 3},
+		LineUp:         point{X: 350, Y: 67},
+		LineDown:       point{X: 350, Y: 949},
+		PageUp:         point{X: 350, Y: 107},
+		PageDown:       point{X: 350, Y: 949},
+		ScrollTrack:    &scrollTrack{X: 351, Y: 76, Height: 868, GripColour: "#ffff00"},
+	}
+	p.TextArea.X = -189
+	p.TextArea.Y = 60
+	p.TextArea.Width = 532
+	return p
+}
+
+// loadProfile reads a geometry profile from a JSON file, see configuration/profiles/scroll_mock.json.
+func loadProfile(fileName string) (*geometryProfile, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	p := &geometryProfile{}
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("profile %v : %v", fileName, err)
+	}
+	if p.Anchor == "" {
+		return nil, fmt.Errorf("profile %v : no 'Anchor' image", fileName)
+	}
+	if p.TextArea.Width <= 0 || p.LinePitch <= 0 || p.LinesPerPage <= 0 {
+		return nil, fmt.Errorf("profile %v : 'TextArea' 'Width', 'LinePitch' and 'LinesPerPage' must all be more than 0", fileName)
+	}
+	if p.ScrollTrack != nil {
+		if p.ScrollTrack.Height <= 0 {
+			return nil, fmt.Errorf("profile %v : 'ScrollTrack' 'Height' must be more than 0", fileName)
+		}
+		if _, err = p.ScrollTrack.gripColour(); err != nil {
+			return nil, fmt.Errorf("profile %v : %v", fileName, err)
+		}
+	}
+	return p, nil
+}
+
+// Geometry of the scroll window in use, see useProfile.
+var (
+	profile    *geometryProfile
+	topWidth   int // width of a line
+	topHeight  int // height of a line
+	linesShown int // lines on a page
+)
+
+// useProfile loads the profile fileName, or the default one if fileName is "", for the rest of the run.
+func useProfile(fileName string) error {
+	p := defaultProfile()
+	if fileName != "" {
+		var err error
+		if p, err = loadProfile(fileName); err != nil {
+			return err
+		}
+	}
+	profile = p
+	topWidth = p.TextArea.Width
+	topHeight = p.LinePitch
+	linesShown = p.LinesPerPage
+	return nil
+}
+
+// at returns the screen position of p, with the anchor found at anchorX, anchorY.
+func (p point) at(anchorX int, anchorY int) (int, int) {
+	return anchorX + p.X, anchorY + p.Y
+}
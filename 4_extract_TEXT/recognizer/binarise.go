@@ -0,0 +1,211 @@
+package recognizer
+
+import "math/bits"
+
+// binariser decides whether a pixel is foreground or background.
+type binariser struct {
+	background uint32
+	scale      [3]int // per colour channel, in 1/256ths, 0 to ignore the channel
+	threshold  int
+}
+
+// newBinariser returns a binariser for pixels drawn on background.
+// With a fixedThreshold a pixel is foreground when any of its red, green or blue values differs
+// from the background's by more than fixedThreshold. Otherwise each channel's difference is scaled
+// by the contrast of that channel across pixels, and a pixel is foreground when it is more than
+// half way from the background to the text. This way the same text drawn in another colour, or
+// on another colour, gives the same mask (even with the colour fringes of sub-pixel smoothing).
+func newBinariser(pixels []uint32, background uint32, fixedThreshold int) binariser {
+	bin := binariser{background: background}
+	if fixedThreshold > 0 {
+		bin.scale = [3]int{256, 256, 256}
+		bin.threshold = fixedThreshold
+		return bin
+	}
+
+	var contrast [3]int
+	for _, p := range pixels {
+		for c := uint(0); c < 3; c++ {
+			d := int((p>>(c*8))&0xFF) - int((background>>(c*8))&0xFF)
+			if d < 0 {
+				d = -d
+			}
+			if d > contrast[c] {
+				contrast[c] = d
+			}
+		}
+	}
+	maxContrast := contrast[0]
+	for _, d := range contrast {
+		if d > maxContrast {
+			maxContrast = d
+		}
+	}
+	if maxContrast == 0 {
+		bin.threshold = 1 << 30 // nothing but background
+		return bin
+	}
+	for c, d := range contrast {
+		if d*4 >= maxContrast { // a channel with little contrast would only add noise
+			bin.scale[c] = 255 * 256 / d
+		}
+	}
+	bin.threshold = 127
+	return bin
+}
+
+// foreground reports whether pixel p differs enough from the background.
+func (bin *binariser) foreground(p uint32) bool {
+	for c := uint(0); c < 3; c++ {
+		d := int((p>>(c*8))&0xFF) - int((bin.background>>(c*8))&0xFF)
+		if d < 0 {
+			d = -d
+		}
+		if (d*bin.scale[c])>>8 > bin.threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// majorityColour returns the colour of more than half of pixels, if there is one,
+// which for a line of text or a set of glyphs is the background.
+// (Boyer-Moore majority vote, so no counting map is needed)
+func majorityColour(pixels []uint32) uint32 {
+	var candidate uint32
+	var count int
+	for _, p := range pixels {
+		if count == 0 {
+			candidate = p
+			count = 1
+		} else if p == candidate {
+			count++
+		} else {
+			count--
+		}
+	}
+	return candidate
+}
+
+// columnMasks sets bit y of masks[x] for each foreground pixel of the column at a time pixels.
+func columnMasks(pixels []uint32, height int, bin binariser, masks []uint64) {
+	offset := 0
+	for x := range masks {
+		var mask uint64
+		for y := 0; y < height; y++ {
+			if bin.foreground(pixels[offset]) {
+				mask |= 1 << uint(y)
+			}
+			offset++
+		}
+		masks[x] = mask
+	}
+}
+
+// initMasks works out the background of face f and the foreground mask of every one of its glyphs.
+func (r *Recognizer) initMasks(f *face) error {
+	if f.Height > 64 {
+		return fontDataError("face %q height %v is more than the 64 rows that can be binarised", f.Name, f.Height)
+	}
+
+	var allPixels []uint32
+	for _, g := range f.glyphs {
+		allPixels = append(allPixels, g.Pixels...)
+	}
+	f.fontBackground = majorityColour(allPixels)
+	bin := newBinariser(allPixels, f.fontBackground, r.options.ForegroundThreshold)
+
+	for b := range f.glyphs {
+		g := &f.glyphs[b]
+		masks := make([]uint64, g.Width)
+		columnMasks(g.Pixels, g.Height, bin, masks)
+
+		// Columns that are blank once binarised are left for the BlankCharacter to match,
+		// as they were only told apart from it by faint colour fringes.
+		for len(masks) > 1 && masks[0] == 0 {
+			masks = masks[1:]
+		}
+		for len(masks) > 1 && masks[len(masks)-1] == 0 {
+			masks = masks[:len(masks)-1]
+		}
+		g.columnMasks = masks
+	}
+
+	f.maskIndex = newGlyphIndex(len(f.glyphs))
+	for b := range f.glyphs {
+		f.maskIndex.add(f.glyphs[b].columnMasks[0], &f.glyphs[b])
+	}
+	return nil
+}
+
+// lineMasks binarises the column at a time pixels of a line, in the rows of face f, into masks.
+func (r *Recognizer) lineMasks(f *face, lineAsUint32 []uint32, masks []uint64) {
+	background := r.options.Background
+	if r.options.DetectBackground {
+		background = majorityColour(lineAsUint32)
+	}
+	columnMasks(lineAsUint32, f.Height, newBinariser(lineAsUint32, background, r.options.ForegroundThreshold), masks)
+}
+
+// maskGlyph returns the widest glyph of face f whose foreground mask is the same as the line's at
+// column x (a mask has less detail than colours, so for example '.' is the start of ','),
+// with priority order deciding between glyphs of the same width. Failing that, with
+// Options.MaxMismatchedPixels set, the glyph with fewest differing mask bits within that limit.
+// It returns nil if there is no match, otherwise the glyph and the number of columns it covers.
+// The same masks are only looked for amongst the glyphs whose first column has the line's mask,
+// and every glyph is only compared in turn when none of them is the same.
+func (r *Recognizer) maskGlyph(f *face, lineMasks []uint64, x int) (*searchGlyph, int) {
+	var best *searchGlyph
+
+	for _, g := range f.maskIndex.lookup(lineMasks[x]) {
+		if (best == nil || len(g.columnMasks) > len(best.columnMasks)) && maskMatch(g, lineMasks, x) {
+			best = g
+		}
+	}
+	if best != nil {
+		return best, len(best.columnMasks)
+	}
+
+	maxMismatched := r.options.MaxMismatchedPixels
+	if maxMismatched == 0 {
+		return nil, 0
+	}
+
+	var bestMismatched int
+	for b := range f.glyphs {
+		g := &f.glyphs[b]
+		if (len(g.columnMasks) + x) > len(lineMasks) {
+			continue
+		}
+		mismatched := 0
+		lineColumns := lineMasks[x : x+len(g.columnMasks)]
+		for c, m := range g.columnMasks {
+			mismatched += bits.OnesCount64(m ^ lineColumns[c])
+		}
+		if mismatched > maxMismatched {
+			continue
+		}
+		if best == nil || mismatched < bestMismatched || (mismatched == bestMismatched && len(g.columnMasks) > len(best.columnMasks)) {
+			best = g
+			bestMismatched = mismatched
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	return best, len(best.columnMasks)
+}
+
+// maskMatch reports whether glyph g has the same foreground mask as the line at column x.
+func maskMatch(g *searchGlyph, lineMasks []uint64, x int) bool {
+	if (len(g.columnMasks) + x) > len(lineMasks) {
+		return false
+	}
+	lineColumns := lineMasks[x : x+len(g.columnMasks)]
+	for c, m := range g.columnMasks {
+		if m != lineColumns[c] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package recognizer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Conversion result codes. These keep the numbering that the extractor has always
+// reported in its log, so existing notes and scripts still make sense.
+const (
+	ConversionGood = iota + 1 // start at 1
+	ConversionErrorOnlyFourDividers
+	ConversionErrorUnknownPixel
+	ConversionErrorWrongNumberOfSections
+	ConversionErrorTimeFormatWrong
+	ConversionErrorBlankLine
+	ConversionErrorFieldInvalid
+)
+
+// ErrFontData is wrapped by every error returned while loading a font set.
+var ErrFontData = errors.New("font data error")
+
+// ErrBadGeometry is returned when a line rectangle does not fit inside the pixel data.
+var ErrBadGeometry = errors.New("line rectangle outside of pixel data")
+
+// ConversionError describes why a line of pixels could not be turned into text.
+type ConversionError struct {
+	Code   int    // one of the ConversionError... constants
+	Detail string // optional extra information, e.g. "field count 4"
+	Text   string // the raw text decoded before the failure (may be empty)
+}
+
+func (e *ConversionError) Error() string {
+	var description string
+	switch e.Code {
+	case ConversionErrorOnlyFourDividers:
+		description = "Found only the vertical dividers - the pixel offset for the line is most likely wrong"
+	case ConversionErrorUnknownPixel:
+		description = "Unknown pixel data"
+	case ConversionErrorWrongNumberOfSections:
+		description = "Line has the wrong number of sections"
+	case ConversionErrorTimeFormatWrong:
+		description = "Time does not have 2 colon seperators"
+	case ConversionErrorBlankLine:
+		description = "Blank line"
+	case ConversionErrorFieldInvalid:
+		description = "Field does not match the schema"
+	default:
+		description = "Unknown conversion error"
+	}
+	s := fmt.Sprintf("error %v : %s", e.Code, description)
+	if e.Detail != "" {
+		s += " : " + e.Detail
+	}
+	return s
+}
+
+// ErrorCode returns the conversion code held in err, ConversionGood for a nil error
+// and 0 for any error that is not a *ConversionError.
+func ErrorCode(err error) int {
+	if err == nil {
+		return ConversionGood
+	}
+	var ce *ConversionError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return 0
+}
@@ -0,0 +1,408 @@
+package recognizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"unsafe"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/atomicfile"
+)
+
+// BlankCharacter is the font character used to signify a blank vertical column of pixels.
+// It is matched like any other glyph, but never appears in the decoded text.
+const BlankCharacter byte = '^'
+
+// Glyph is one character bitmap, stored a column at a time as 0x00RRGGBB pixels so that
+// it can be compared directly against the raw data returned by X11 / robotgo.
+type Glyph struct {
+	Character uint8
+	Face      string // name of the Face it belongs to
+	Width     int
+	Height    int
+	Pixels    []uint32
+}
+
+// Face is one style of the characters of a font set, e.g. bold headers or a coloured alarm font.
+// All glyphs of a face are the same height and sit at the same vertical position in a line.
+type Face struct {
+	Name    string // "" for a font set that does not name its faces
+	Height  int    // rows of pixels compared for every glyph
+	YOffset int    // rows down from the top of a line to where the glyphs start
+}
+
+// FontSet is the collection of glyphs a Recognizer searches for, in one or more faces.
+// The same character may be in several faces, or more than once in a face as variants.
+type FontSet struct {
+	Glyphs []Glyph
+	Faces  []Face // in the order of the description file, which is the order they are tried in
+
+	// SearchOrder is the character order the glyphs have been arranged into, either as
+	// recorded in the description file by RecordSearchOrder or by Prioritize, nil for neither.
+	SearchOrder []byte
+}
+
+type bitmapSourceInfo struct {
+	Character   string
+	Width       int
+	Height      int
+	XOffset     int
+	YOffset     int
+	LineYOffset int
+	FileName    string
+	Face        string
+	SearchOrder int
+}
+
+// fontDataError wraps ErrFontData with the detail of what is wrong.
+func fontDataError(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFontData, fmt.Sprintf(format, a...))
+}
+
+// numberField validates a numerical field of one font description entry.
+func numberField(result map[string]interface{}, key int, name string, min float64, max float64) (int, error) {
+	switch v := result[name].(type) {
+	case float64: // the json.Unmarshal makes the int into a float64
+		if v < min || v > max {
+			return 0, fontDataError("'%s' field can only be >= %v AND <= %v, NOT : %v (font index %v)", name, min, max, v, key)
+		}
+		return int(v), nil
+	default:
+		// if the field is missing, the following will show it as <nil>
+		return 0, fontDataError("'%s' field is NOT int, it's : %v (font index %v : %v)", name, result[name], key, result)
+	}
+}
+
+// LoadFontSet reads the font description JSON in descriptionFile and extracts each
+// described character from the .png files found in fontDir.
+// Entries whose 'FileName' is "?" are skipped, as they have yet to be filled in.
+func LoadFontSet(descriptionFile string, fontDir string) (*FontSet, error) {
+	// read the font bitmap info into look up array structure
+	fontDescriptionData, err := ioutil.ReadFile(descriptionFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Declared an empty interface of type Array
+	var results []map[string]interface{}
+
+	// Unmarshal or Decode the JSON to the interface.
+	if err = json.Unmarshal(fontDescriptionData, &results); err != nil {
+		return nil, fontDataError("%v", err)
+	}
+
+	allFontsSource := []bitmapSourceInfo{}
+
+	for key, result := range results {
+		// Validate every field, stop if problem, otherwise save
+		// (skip character without filename)
+		var n bitmapSourceInfo
+
+		switch v := result["Character"].(type) { // do "type assertion" for all required fields
+		case string:
+			if len(v) != 1 {
+				return nil, fontDataError("'Character' field can only be ONE character, NOT : %q (font index %v)", v, key)
+			}
+			n.Character = v
+		default:
+			return nil, fontDataError("'Character' field is NOT string, it's : %v (font index %v : %v)", result["Character"], key, result)
+		}
+
+		switch v := result["FileName"].(type) {
+		case string:
+			if len(v) == 0 {
+				return nil, fontDataError("'FileName' field empty (font index %v)", key)
+			}
+			if v == "?" {
+				continue // skip saving any info for this one
+			}
+			n.FileName = v
+		default:
+			return nil, fontDataError("'FileName' field is NOT string, it's : %v (font index %v : %v)", result["FileName"], key, result)
+		}
+
+		if n.Width, err = numberField(result, key, "Width", 1, 30); err != nil {
+			return nil, err
+		}
+		if n.Height, err = numberField(result, key, "Height", 1, 40); err != nil {
+			return nil, err
+		}
+		if n.XOffset, err = numberField(result, key, "XOffset", 0, 4000); err != nil {
+			return nil, err
+		}
+		if n.YOffset, err = numberField(result, key, "YOffset", 0, 3000); err != nil {
+			return nil, err
+		}
+
+		// 'LineYOffset' is optional, without it the font source .png is taken to be a
+		// single line of text, so that 'YOffset' is also the position within a line.
+		n.LineYOffset = n.YOffset
+		if _, ok := result["LineYOffset"]; ok {
+			if n.LineYOffset, err = numberField(result, key, "LineYOffset", 0, 40); err != nil {
+				return nil, err
+			}
+		}
+
+		// 'Face' is optional, characters without one are all in the one unnamed face
+		switch v := result["Face"].(type) {
+		case nil:
+		case string:
+			n.Face = v
+		default:
+			return nil, fontDataError("'Face' field is NOT string, it's : %v (font index %v : %v)", result["Face"], key, result)
+		}
+
+		// 'SearchOrder' is optional, it is written by RecordSearchOrder
+		if _, ok := result["SearchOrder"]; ok {
+			if n.SearchOrder, err = numberField(result, key, "SearchOrder", 1, 10000); err != nil {
+				return nil, err
+			}
+		}
+
+		allFontsSource = append(allFontsSource, n)
+	}
+
+	if len(allFontsSource) == 0 {
+		return nil, fontDataError("no characters in %v", descriptionFile)
+	}
+
+	fonts := &FontSet{Glyphs: make([]Glyph, 0, len(allFontsSource))}
+	faces := make(map[string]int) // index into fonts.Faces
+	for _, source := range allFontsSource {
+		i, ok := faces[source.Face]
+		if !ok {
+			faces[source.Face] = len(fonts.Faces)
+			fonts.Faces = append(fonts.Faces, Face{Name: source.Face, Height: source.Height, YOffset: source.LineYOffset})
+			continue
+		}
+		if source.Height != fonts.Faces[i].Height || source.LineYOffset != fonts.Faces[i].YOffset {
+			return nil, fontDataError("'%s' is %v high at line offset %v, but face %q is %v high at line offset %v - all characters of a face must match",
+				source.Character, source.Height, source.LineYOffset, source.Face, fonts.Faces[i].Height, fonts.Faces[i].YOffset)
+		}
+	}
+
+	// any entries added by hand since the order was recorded go after the ordered ones
+	sort.SliceStable(allFontsSource, func(a, b int) bool {
+		return allFontsSource[a].SearchOrder != 0 && (allFontsSource[b].SearchOrder == 0 || allFontsSource[a].SearchOrder < allFontsSource[b].SearchOrder)
+	})
+	for _, source := range allFontsSource {
+		if source.SearchOrder != 0 {
+			fonts.SearchOrder = append(fonts.SearchOrder, source.Character[0])
+		}
+	}
+
+	pictures := make(map[string]*image.NRGBA) // several glyphs usually come from the same .png
+	for _, source := range allFontsSource {
+		pictureRGBA, ok := pictures[source.FileName]
+		if !ok {
+			pictureRGBA, err = loadFontPNG(filepath.Join(fontDir, source.FileName))
+			if err != nil {
+				return nil, err
+			}
+			pictures[source.FileName] = pictureRGBA
+		}
+
+		if source.XOffset+source.Width > pictureRGBA.Rect.Dx() || source.YOffset+source.Height > pictureRGBA.Rect.Dy() {
+			return nil, fontDataError("'%s' lies outside of %v", source.Character, source.FileName)
+		}
+
+		fonts.Glyphs = append(fonts.Glyphs, Glyph{
+			Character: source.Character[0],
+			Face:      source.Face,
+			Width:     source.Width,
+			Height:    source.Height,
+			Pixels:    extractGlyphPixels(pictureRGBA, source.XOffset, source.YOffset, source.Width, source.Height),
+		})
+	}
+
+	return fonts, nil
+}
+
+func loadFontPNG(fontFile string) (*image.NRGBA, error) {
+	infile, err := os.Open(fontFile)
+	if err != nil {
+		return nil, fontDataError("can't open font file : %v", err)
+	}
+	defer infile.Close()
+
+	picture, err := png.Decode(infile)
+	if err != nil {
+		return nil, fontDataError("can't decode .png file %v : %v", fontFile, err)
+	}
+
+	pictureRGBA, _ := picture.(*image.NRGBA)
+	if pictureRGBA == nil || pictureRGBA.Rect.Min != (image.Point{}) {
+		// e.g. a .png without an alpha channel, such as those saved by UnknownGlyphs
+		pictureRGBA = image.NewNRGBA(image.Rect(0, 0, picture.Bounds().Dx(), picture.Bounds().Dy()))
+		draw.Draw(pictureRGBA, pictureRGBA.Rect, picture, picture.Bounds().Min, draw.Src)
+	}
+
+	if pictureRGBA.Stride != picture.Bounds().Dx()*4 {
+		return nil, fontDataError("unsupported stride : %v", fontFile)
+	}
+
+	alignmentBoundary := unsafe.Alignof(pictureRGBA.Pix)
+	if alignmentBoundary%4 != 0 {
+		return nil, fontDataError("Pix data is not aligned on 4 byte boundary for *uint32 access")
+	}
+
+	return pictureRGBA, nil
+}
+
+// extractGlyphPixels copies a glyph out of its source picture a column at a time.
+func extractGlyphPixels(pictureRGBA *image.NRGBA, xOffset int, yOffset int, width int, height int) []uint32 {
+	extractedPixels := make([]uint32, width*height)
+	var offset int
+	var yPos int
+	var sourcePix uint32
+	var r uint8
+	var g uint8
+	var b uint8
+
+	// pixels are extracted a column at a time
+	for x := xOffset; x < xOffset+width; x++ {
+		yPos = yOffset*pictureRGBA.Stride + x*4
+		for y := 0; y < height; y++ {
+			sourcePix = *(*uint32)(unsafe.Pointer(&pictureRGBA.Pix[yPos]))
+			// re-organise RED, GREEN, BLUE and Alpha to match ordering in robotgo's
+			// byte array as returned from robotgo.ToBitmapBytes()
+			b = (uint8)(sourcePix & 0xFF)
+			g = (uint8)((sourcePix >> 8) & 0xFF)
+			r = (uint8)((sourcePix >> 16) & 0xFF)
+
+			// put bytes into order that matches raw data that robotgo AND xImg return
+			extractedPixels[offset] = uint32(b)<<16 | uint32(g)<<8 | uint32(r) // Alpha is '0' in highest byte
+
+			yPos += pictureRGBA.Stride
+			offset++
+		}
+	}
+
+	return extractedPixels
+}
+
+// Prioritize returns a copy of the font set with its glyphs re-arranged into the order
+// given by extractionList, to get minimum execution time when decoding lines.
+// This optimisation saves maybe ~ 40% ... depends on application domain.
+// Glyphs whose character is not in extractionList are kept, after all the listed ones.
+func (f *FontSet) Prioritize(extractionList []byte) *FontSet {
+	prioritized := &FontSet{Glyphs: make([]Glyph, 0, len(f.Glyphs)), Faces: f.Faces, SearchOrder: extractionList}
+	var listed [256]bool
+
+	for _, v := range extractionList {
+		if listed[v] {
+			continue
+		}
+		listed[v] = true
+		for _, g := range f.Glyphs {
+			if g.Character == v {
+				prioritized.Glyphs = append(prioritized.Glyphs, g)
+			}
+		}
+	}
+	for _, g := range f.Glyphs {
+		if !listed[g.Character] {
+			prioritized.Glyphs = append(prioritized.Glyphs, g)
+		}
+	}
+
+	return prioritized
+}
+
+// FontEntry is one character of a font description file.
+type FontEntry struct {
+	Character   string
+	Width       int
+	Height      int
+	XOffset     int
+	YOffset     int
+	LineYOffset int
+	FileName    string
+	Face        string `json:",omitempty"`
+}
+
+// AppendFontEntry adds entry to the end of the font description file.
+func AppendFontEntry(descriptionFile string, entry FontEntry) error {
+	entries, err := readFontDescription(descriptionFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	var newEntry map[string]json.RawMessage
+	if err = json.Unmarshal(data, &newEntry); err != nil {
+		return err
+	}
+	return writeFontDescription(descriptionFile, append(entries, newEntry))
+}
+
+// readFontDescription reads the entries of a font description file, keeping every field as it is.
+func readFontDescription(descriptionFile string) ([]map[string]json.RawMessage, error) {
+	fontDescriptionData, err := ioutil.ReadFile(descriptionFile)
+	if err != nil {
+		return nil, err
+	}
+	var entries []map[string]json.RawMessage
+	if err = json.Unmarshal(fontDescriptionData, &entries); err != nil {
+		return nil, fontDataError("%v", err)
+	}
+	return entries, nil
+}
+
+// fontDescriptionKeys is the order fields are written back to a font description file,
+// any other fields follow in alphabetical order.
+var fontDescriptionKeys = []string{"Character", "Width", "Height", "XOffset", "YOffset", "LineYOffset", "FileName", "Face", "SearchOrder"}
+
+// writeFontDescription replaces the font description file with entries, laid out
+// the same way as the hand written files.
+func writeFontDescription(descriptionFile string, entries []map[string]json.RawMessage) error {
+	knownKeys := make(map[string]bool)
+	for _, k := range fontDescriptionKeys {
+		knownKeys[k] = true
+	}
+
+	var out bytes.Buffer
+	out.WriteString("[\n")
+	for i, entry := range entries {
+		var keys, others []string
+		for _, k := range fontDescriptionKeys {
+			if _, ok := entry[k]; ok {
+				keys = append(keys, k)
+			}
+		}
+		for k := range entry {
+			if !knownKeys[k] {
+				others = append(others, k)
+			}
+		}
+		sort.Strings(others)
+		keys = append(keys, others...)
+
+		out.WriteString("    {\n")
+		for j, k := range keys {
+			name, _ := json.Marshal(k)
+			fmt.Fprintf(&out, "        %s: %s", name, bytes.TrimSpace(entry[k]))
+			if j < len(keys)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString("    }")
+		if i < len(entries)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("]\n")
+
+	return atomicfile.WriteFile(descriptionFile, out.Bytes())
+}
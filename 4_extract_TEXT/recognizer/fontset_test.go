@@ -0,0 +1,136 @@
+package recognizer
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The two face fixture : '1', '2' and '|' in an unnamed face 5 rows high, 4 rows down a line, and
+// '1' and '!' in a red "alarm" face 7 rows high, 1 row down. Both faces have a '1' and a blank column.
+const (
+	testTwoFaces     = "testdata/two_faces.json"
+	testTwoFacesDir  = "testdata"
+	testTwoFacesLine = "testdata/two_faces_line.png" // "12|" then "!1" in the alarm face
+)
+
+func TestLoadFontSetFaces(t *testing.T) {
+	fonts, err := LoadFontSet(testTwoFaces, testTwoFacesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFaces := []Face{{Name: "", Height: 5, YOffset: 4}, {Name: "alarm", Height: 7, YOffset: 1}}
+	if len(fonts.Faces) != len(wantFaces) {
+		t.Fatalf("faces %+v, want %+v", fonts.Faces, wantFaces)
+	}
+	for i, f := range wantFaces {
+		if fonts.Faces[i] != f {
+			t.Errorf("face %v is %+v, want %+v", i, fonts.Faces[i], f)
+		}
+	}
+
+	ones := make(map[string]Glyph)
+	for _, g := range fonts.Glyphs {
+		if (g.Face == "" && g.Height != 5) || (g.Face == "alarm" && g.Height != 7) {
+			t.Errorf("'%c' of face %q is %v high", g.Character, g.Face, g.Height)
+		}
+		if g.Character == '1' {
+			ones[g.Face] = g
+		}
+	}
+	if len(fonts.Glyphs) != 7 || len(ones) != 2 {
+		t.Fatalf("%v glyphs with a '1' in %v faces, want 7 with one in each face", len(fonts.Glyphs), len(ones))
+	}
+	// the pixels are in the colour of the face, 0x00RRGGBB, a column at a time
+	if p := ones[""].Pixels[1]; p != 0xFFFFFF {
+		t.Errorf("the second pixel of '1' is %06x, want white", p)
+	}
+	if p := ones["alarm"].Pixels[1]; p != 0xFF0000 {
+		t.Errorf("the second pixel of the alarm '1' is %06x, want red", p)
+	}
+}
+
+func TestLoadFontSetFaceMismatch(t *testing.T) {
+	entries, err := readFontDescription(testTwoFaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "recognizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	copyFile(t, filepath.Join(testTwoFacesDir, "two_faces.png"), dir)
+	descriptionFile := filepath.Join(dir, "two_faces.json")
+
+	for _, change := range []struct{ key, value string }{
+		{"LineYOffset", "2"}, // the '!' is not at the line offset of the rest of its face
+		{"Height", "6"},
+		{"Face", `""`}, // the '!' is not the height of the unnamed face
+	} {
+		changed := make([]map[string]json.RawMessage, len(entries))
+		for i, entry := range entries {
+			changed[i] = make(map[string]json.RawMessage)
+			for k, v := range entry {
+				changed[i][k] = v
+			}
+		}
+		changed[5][change.key] = json.RawMessage(change.value)
+		if err = writeFontDescription(descriptionFile, changed); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = LoadFontSet(descriptionFile, dir); !errors.Is(err, ErrFontData) {
+			t.Errorf("%v %v : got %v, want a font data error", change.key, change.value, err)
+		}
+	}
+}
+
+func TestRowFaces(t *testing.T) {
+	fonts, err := LoadFontSet(testTwoFaces, testTwoFacesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := &Schema{Separators: "|", Delimiter: ",", Fields: []Field{{Name: "Value", Type: FieldInt}, {Name: "Alarm"}}}
+	if err = schema.compile(); err != nil {
+		t.Fatal(err)
+	}
+	img := readTestPNG(t, testTwoFacesLine)
+
+	r, err := New(fonts, Options{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := r.RowImage(img, img.Bounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Text != "12,!1" || len(row.Fields) != 2 || row.Fields[1] != "!1" {
+		t.Errorf("got %+v, want \"12,!1\"", row)
+	}
+
+	// each character is found in its own face, the '1' in both
+	matches, err := r.MatchesImage(img, img.Bounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Match{{'1', "", 1, 3}, {'2', "", 5, 3}, {'|', "", 9, 1}, {'!', "alarm", 11, 1}, {'1', "alarm", 13, 3}}
+	if len(matches) != len(want) {
+		t.Fatalf("got %+v, want %+v", matches, want)
+	}
+	for i := range want {
+		if matches[i] != want[i] {
+			t.Errorf("got %+v, want %+v", matches[i], want[i])
+		}
+	}
+
+	// a line too short for the rows of the unnamed face
+	if _, err = r.RowImage(img, image.Rect(0, 0, img.Bounds().Dx(), 8)); err != ErrBadGeometry {
+		t.Errorf("8 rows gave %v, want ErrBadGeometry", err)
+	}
+}
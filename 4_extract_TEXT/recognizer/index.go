@@ -0,0 +1,61 @@
+package recognizer
+
+// glyphIndex is a small open addressing hash table of the glyphs whose first column has a
+// given signature (columnHash of its pixels, or its foreground mask), so that the cost of finding
+// the candidate glyphs for a column does not depend on how many glyphs there are or on their
+// priority order. Glyphs that share a signature are kept in priority order.
+type glyphIndex struct {
+	shift uint
+	slots []indexSlot
+}
+
+type indexSlot struct {
+	used      bool
+	signature uint64
+	glyphs    []*searchGlyph
+}
+
+// newGlyphIndex makes an index with room for at least n different signatures,
+// sized so that most lookups find their slot first time.
+func newGlyphIndex(n int) glyphIndex {
+	size := 8
+	shift := uint(64 - 3)
+	for size < n*4 {
+		size *= 2
+		shift--
+	}
+	return glyphIndex{shift: shift, slots: make([]indexSlot, size)}
+}
+
+func (ix *glyphIndex) slot(signature uint64) int {
+	return int((signature * 0x9E3779B97F4A7C15) >> ix.shift) // Fibonacci hashing
+}
+
+func (ix *glyphIndex) add(signature uint64, g *searchGlyph) {
+	mask := len(ix.slots) - 1
+	for i := ix.slot(signature); ; i = (i + 1) & mask {
+		s := &ix.slots[i]
+		if !s.used {
+			s.used = true
+			s.signature = signature
+		}
+		if s.signature == signature {
+			s.glyphs = append(s.glyphs, g)
+			return
+		}
+	}
+}
+
+// lookup returns the glyphs whose first column has signature, in priority order.
+func (ix *glyphIndex) lookup(signature uint64) []*searchGlyph {
+	mask := len(ix.slots) - 1
+	for i := ix.slot(signature); ; i = (i + 1) & mask {
+		s := &ix.slots[i]
+		if !s.used {
+			return nil
+		}
+		if s.signature == signature {
+			return s.glyphs
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package recognizer
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// originalDecode is the matcher of 4_extract_Text before the recognizer package, bitmapToString without
+// the row formatting, kept to benchmark the recognizer against. It only works for 13 row high glyphs
+// 2 rows down a line, searched in the order of glyphs.
+func originalDecode(glyphs []Glyph, pix []byte, lineWidth int, priorKnowledgeSpeedup bool) string {
+	var yDownStart int = 2     // all font bitmaps to be searched for start 2 pixels down (a hardwired optimisation)
+	var maxFontHeight int = 13 // this is defined to clip the last line of a comma (a hardwired optimisation)
+	var lineAsUint32 = make([]uint32, lineWidth*maxFontHeight)
+
+	var stride int = lineWidth * 4 // 4 bytes per pixel
+	var offset int
+	var yPos int
+	for x := 0; x < lineWidth; x++ {
+		yPos = (yDownStart * stride) + (x * 4) // initialise row for start of each column
+		for y := 0; y < maxFontHeight; y++ {
+			lineAsUint32[offset] = *(*uint32)(unsafe.Pointer(&pix[yPos]))
+			yPos += stride // advance to the next row
+			offset++
+		}
+	}
+
+	var columnOffsetIntoLine int
+	var lineText string
+	var lineOffset int
+	var fontOffset int
+
+	for columnOffsetIntoLine < lineWidth {
+		found := false
+		for b := 0; b < len(glyphs); b++ {
+			if (glyphs[b].Width + columnOffsetIntoLine) <= lineWidth {
+				var w = glyphs[b].Width
+				if priorKnowledgeSpeedup && w > 4 {
+					w = 4 // minimum number of columns that work for fonts used
+				}
+				lineOffset = columnOffsetIntoLine * maxFontHeight
+				fontOffset = 0
+				for w1 := 0; w1 < w; w1++ {
+					// Unroll the inner loop 13 times (the height of font searched for)
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+					if glyphs[b].Pixels[fontOffset] != lineAsUint32[lineOffset] {
+						goto notSame
+					}
+					fontOffset++
+					lineOffset++
+				}
+				columnOffsetIntoLine += glyphs[b].Width
+				if glyphs[b].Character != BlankCharacter {
+					lineText += string(glyphs[b].Character)
+				}
+				found = true
+				break
+			notSame:
+			}
+		}
+		if !found {
+			columnOffsetIntoLine++
+		}
+	}
+	return lineText
+}
+
+func TestDecodeMatchesOriginal(t *testing.T) {
+	fonts, err := LoadFontSet(testFontDescription, testFontDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fonts = fonts.Prioritize([]byte(tunedOrder))
+	r, err := New(fonts, Options{PriorKnowledgeSpeedup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pix := range testPage(t) {
+		want := originalDecode(fonts.Glyphs, pix, testLineWidth, true)
+		got, err := r.Decode(pix, testLineWidth*4, testLineRect)
+		if err != nil || got != want {
+			t.Fatalf("got %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func BenchmarkPageOriginal(b *testing.B) {
+	fonts, err := LoadFontSet(testFontDescription, testFontDir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	glyphs := fonts.Prioritize([]byte(tunedOrder)).Glyphs
+	page := testPage(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pix := range page {
+			originalDecode(glyphs, pix, testLineWidth, true)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+// Package recognizer converts lines of screen grabbed pixels into text by searching
+// them for the character bitmaps of a known font set.
+package recognizer
+
+import (
+	"image"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Options tune how a Recognizer searches a line.
+type Options struct {
+	// PriorKnowledgeSpeedup compares at most the first 4 columns of each glyph.
+	// Only use this if the first 'x' columns of the fonts are unique.
+	PriorKnowledgeSpeedup bool
+
+	// GatherCharacterCounts accumulates how often each character is found, see CharacterCounts().
+	GatherCharacterCounts bool
+
+	// ColourTolerance and MaxMismatchedPixels turn on tolerant matching for text that is
+	// anti-aliased or slightly off-colour. Where no glyph matches exactly, a pixel counts as
+	// the same when each of its red, green and blue values is within ColourTolerance of the
+	// glyph's, and a glyph matches with up to MaxMismatchedPixels pixels that are not the same.
+	// When several glyphs match, the one with fewest mismatched pixels is chosen.
+	ColourTolerance     int
+	MaxMismatchedPixels int
+
+	// Binarise compares 1-bit foreground masks instead of colours, so that the colour of the
+	// text and of the row behind it no longer matter. A pixel is foreground when any of its
+	// red, green or blue values differs from the background by more than ForegroundThreshold,
+	// or if that is 0, when it is more than half way from the background to the text colour.
+	// The background of each line is Background (0x00RRGGBB), or is detected for every line
+	// when DetectBackground is set.
+	// MaxMismatchedPixels also applies, as the number of mask bits allowed to differ.
+	Binarise            bool
+	Background          uint32
+	DetectBackground    bool
+	ForegroundThreshold int
+
+	// SpaceWidth turns the gaps between characters into spaces. A run of at least SpaceWidth
+	// blank columns between two characters is decoded as Space (" " if that is empty), which
+	// can also be a field separator such as "|". A SpaceWidth of -1 takes half the average
+	// width of the characters of the font set, 0 leaves gaps out as before.
+	SpaceWidth int
+	Space      string
+
+	// Schema checks and formats the rows returned by Line, nil for DefaultSchema().
+	Schema *Schema
+
+	// Unknown, when not nil, collects each run of pixel columns that no glyph matched,
+	// which would otherwise be skipped without trace.
+	Unknown *UnknownGlyphs
+}
+
+// Recognizer decodes lines of pixels using a FontSet.
+// It is safe for concurrent use by multiple goroutines.
+type Recognizer struct {
+	faces   []*face // in font set order, which is the order they are tried in
+	options Options
+
+	schema     *Schema
+	spaceWidth int    // blank columns that make a space, 0 for none
+	space      string // what a space is decoded as
+
+	mutex      sync.Mutex
+	charCounts [256]uint64
+
+	lineBuffers sync.Pool // of *lineBuffers, re-used to save garbage collection
+}
+
+// face is the glyphs of one Face of the font set, in priority order, with the indexes to find them by.
+type face struct {
+	Face
+	glyphs []searchGlyph
+
+	fontBackground uint32 // the colour behind the glyphs, when binarising
+
+	// glyphs looked up by the columnHash of their first column,
+	// or (when binarising) its foreground mask
+	hashIndex glyphIndex
+	maskIndex glyphIndex
+}
+
+// lineBuffers holds the rows of a line that each face is compared with.
+type lineBuffers struct {
+	faces []faceLine
+}
+
+type faceLine struct {
+	pixels []uint32
+	masks  []uint64
+}
+
+// searchGlyph is a Glyph along with, when binarising, the foreground mask of each of its columns.
+type searchGlyph struct {
+	Glyph
+	columnMasks []uint64
+}
+
+// Match is one character found in a line, see DecodeMatches.
+type Match struct {
+	Character byte
+	Face      string // name of the Face whose glyph matched
+	X         int    // first column of the line the glyph covers
+	Width     int    // number of columns it covers
+}
+
+// New creates a Recognizer that searches for the glyphs of each face of fonts in the order they are held.
+// It returns an error wrapping ErrFontData if the glyphs are not all the height of their face.
+func New(fonts *FontSet, options Options) (*Recognizer, error) {
+	if len(fonts.Faces) == 0 {
+		return nil, fontDataError("font set has no faces")
+	}
+
+	r := &Recognizer{options: options}
+
+	faces := make(map[string]*face)
+	for _, fc := range fonts.Faces {
+		if fc.Height < 1 || fc.YOffset < 0 {
+			return nil, fontDataError("face %q height %v at line offset %v is not usable", fc.Name, fc.Height, fc.YOffset)
+		}
+		if faces[fc.Name] != nil {
+			return nil, fontDataError("face %q is in the font set twice", fc.Name)
+		}
+		f := &face{Face: fc}
+		faces[fc.Name] = f
+		r.faces = append(r.faces, f)
+	}
+
+	for _, g := range fonts.Glyphs {
+		f := faces[g.Face]
+		if f == nil {
+			return nil, fontDataError("'%c' is in face %q, which is not one of the font set's faces", g.Character, g.Face)
+		}
+		if g.Height != f.Height || g.Width < 1 || len(g.Pixels) != g.Width*g.Height {
+			return nil, fontDataError("'%c' is %vx%v with %v pixels, the height of face %q is %v", g.Character, g.Width, g.Height, len(g.Pixels), f.Name, f.Height)
+		}
+		f.glyphs = append(f.glyphs, searchGlyph{Glyph: g})
+	}
+
+	for _, f := range r.faces {
+		if len(f.glyphs) == 0 {
+			return nil, fontDataError("face %q has no glyphs", f.Name)
+		}
+		f.hashIndex = newGlyphIndex(len(f.glyphs))
+		for b := range f.glyphs {
+			g := &f.glyphs[b]
+			f.hashIndex.add(columnHash(g.Pixels[:g.Height]), g)
+		}
+
+		if options.Binarise {
+			if err := r.initMasks(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r.schema = options.Schema
+	if r.schema == nil {
+		r.schema = DefaultSchema()
+	}
+
+	r.spaceWidth, r.space = options.SpaceWidth, options.Space
+	if r.space == "" {
+		r.space = " "
+	}
+	if r.spaceWidth < 0 {
+		var total, n int
+		for _, f := range r.faces {
+			for _, g := range f.glyphs {
+				if g.Character != BlankCharacter {
+					total += g.Width
+					n++
+				}
+			}
+		}
+		r.spaceWidth = 2
+		if n > 0 && total/(2*n) > r.spaceWidth {
+			r.spaceWidth = total / (2 * n)
+		}
+	}
+
+	r.lineBuffers.New = func() interface{} {
+		return &lineBuffers{faces: make([]faceLine, len(r.faces))}
+	}
+
+	return r, nil
+}
+
+const (
+	fnvOffsetBasis uint64 = 14695981039346656037
+	fnvPrime       uint64 = 1099511628211
+)
+
+// columnHash is an FNV-1a hash of one column of pixels.
+func columnHash(pixels []uint32) uint64 {
+	h := fnvOffsetBasis
+	for _, p := range pixels {
+		h = (h ^ uint64(p)) * fnvPrime
+	}
+	return h
+}
+
+// CharacterCounts returns how many times each character has been found so far
+// (only gathered when Options.GatherCharacterCounts is set).
+func (r *Recognizer) CharacterCounts() [256]uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.charCounts
+}
+
+// Line converts the line of pixels at rect within pix into the text of one row, as laid out by the schema.
+// pix holds 4 bytes per pixel in the X11 ZPixmap order (blue, green, red, unused) and stride
+// is the number of bytes from one row of pixels to the next.
+func (r *Recognizer) Line(pix []byte, stride int, rect image.Rectangle) (string, error) {
+	row, err := r.Row(pix, stride, rect)
+	return row.Text, err
+}
+
+// Row is Line, also returning the fields of the row.
+func (r *Recognizer) Row(pix []byte, stride int, rect image.Rectangle) (Row, error) {
+	lineText, err := r.Decode(pix, stride, rect)
+	if err != nil {
+		return Row{}, err
+	}
+	return r.schema.Row(lineText)
+}
+
+// Schema is the schema rows are checked and formatted with.
+func (r *Recognizer) Schema() *Schema {
+	return r.schema
+}
+
+// LineImage is Line for a decoded image, such as a screenshot read from a .png file.
+func (r *Recognizer) LineImage(img image.Image, rect image.Rectangle) (string, error) {
+	row, err := r.RowImage(img, rect)
+	return row.Text, err
+}
+
+// RowImage is Row for a decoded image.
+func (r *Recognizer) RowImage(img image.Image, rect image.Rectangle) (Row, error) {
+	pix, stride := imageToPixels(img, rect)
+	return r.Row(pix, stride, image.Rect(0, 0, rect.Dx(), rect.Dy()))
+}
+
+// MatchesImage is DecodeMatches for a decoded image, such as a screenshot read from a .png file.
+func (r *Recognizer) MatchesImage(img image.Image, rect image.Rectangle) ([]Match, error) {
+	pix, stride := imageToPixels(img, rect)
+	return r.DecodeMatches(pix, stride, image.Rect(0, 0, rect.Dx(), rect.Dy()))
+}
+
+// Decode returns the raw characters found in the line of pixels at rect, without
+// applying any of the row formatting rules that Line does.
+func (r *Recognizer) Decode(pix []byte, stride int, rect image.Rectangle) (string, error) {
+	return r.decode(pix, stride, rect, nil)
+}
+
+// DecodeMatches is Decode, but returns each character found along with the face it was found in and where.
+func (r *Recognizer) DecodeMatches(pix []byte, stride int, rect image.Rectangle) ([]Match, error) {
+	matches := []Match{}
+	if _, err := r.decode(pix, stride, rect, &matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// decode does the work of Decode, also adding each character found to matches, if it is not nil.
+func (r *Recognizer) decode(pix []byte, stride int, rect image.Rectangle, matches *[]Match) (string, error) {
+
+	// As this is used for MAX speed, the bounds are checked once here so that the
+	// column extraction below can not go outside of pix.
+
+	// pix[] is only read from, so its use has no concurrency issues when this function
+	// is called from multiple go routines.
+
+	if rect.Empty() || rect.Min.X < 0 || rect.Min.Y < 0 || rect.Max.X*4 > stride {
+		return "", ErrBadGeometry
+	}
+	for _, f := range r.faces {
+		if rect.Dy() < f.YOffset+f.Height || (rect.Min.Y+f.YOffset+f.Height-1)*stride+rect.Max.X*4 > len(pix) {
+			return "", ErrBadGeometry
+		}
+	}
+
+	lineWidth := rect.Dx()
+	buffers := r.lineBuffers.Get().(*lineBuffers)
+	defer r.lineBuffers.Put(buffers)
+
+	baseOffset := rect.Min.Y*stride + rect.Min.X*4
+
+	for i, f := range r.faces {
+		height := f.Height
+		fl := &buffers.faces[i]
+		if cap(fl.pixels) < lineWidth*height {
+			fl.pixels = make([]uint32, lineWidth*height)
+		}
+		var lineAsUint32 = fl.pixels[:lineWidth*height]
+
+		// Generate an array of the pixels for quick comparison
+		// We copy each column of pixels as a uint32 into one long array, consecutively
+		var offset int
+		var yPos int
+
+		// Pixels are extracted a column at a time, from the rows of the line the face is drawn in.
+		//
+		offset = 0
+		for x := 0; x < lineWidth; x++ {
+			yPos = baseOffset + (f.YOffset * stride) + (x * 4) // initialise row for start of each column
+			for y := 0; y < height; y++ {
+				lineAsUint32[offset] = *(*uint32)(unsafe.Pointer(&pix[yPos])) & 0xFFFFFF // ignore the unused top byte
+				yPos += stride                                                           // advance to the next row
+				offset++
+			}
+		}
+
+		if r.options.Binarise {
+			if cap(fl.masks) < lineWidth {
+				fl.masks = make([]uint64, lineWidth)
+			}
+			r.lineMasks(f, lineAsUint32, fl.masks[:lineWidth])
+		}
+	}
+
+	// ====================
+
+	// search for bitmap match
+	var columnOffsetIntoLine int = 0
+
+	var lineText strings.Builder
+
+	var xCount int
+	var blankColumns int // since the last character, to find the gaps between words
+
+	var unknownRuns []unknownRun
+	unknownStart := -1
+	lastFace := -1 // of the last character found, for the rows of the runs after it to be saved from
+
+	for columnOffsetIntoLine < lineWidth {
+		g, width, faceIndex := r.glyphAt(buffers, lineWidth, columnOffsetIntoLine)
+		if g == nil {
+			// somehow the first column on a line gets messed up ... so try the next column
+			// possibly the images are not aligned properly ?
+			if unknownStart < 0 {
+				unknownStart = columnOffsetIntoLine
+			}
+			columnOffsetIntoLine++
+			continue
+		}
+		if unknownStart >= 0 {
+			unknownRuns = append(unknownRuns, unknownRun{start: unknownStart, end: columnOffsetIntoLine, textPos: lineText.Len(), face: lastFace})
+			unknownStart = -1
+			blankColumns = 0 // what was not recognised might not have been a gap
+		}
+
+		if g.Character != BlankCharacter {
+			if lastFace < 0 {
+				// the runs at the start of the line are of the face of its first character
+				for i := range unknownRuns {
+					unknownRuns[i].face = faceIndex
+				}
+			}
+			lastFace = faceIndex
+			if r.spaceWidth > 0 && blankColumns >= r.spaceWidth && lineText.Len() > 0 {
+				lineText.WriteString(r.space)
+			}
+			blankColumns = 0
+			lineText.WriteByte(g.Character)
+			if matches != nil {
+				*matches = append(*matches, Match{Character: g.Character, Face: g.Face, X: columnOffsetIntoLine, Width: width})
+			}
+		} else {
+			blankColumns += width
+			if r.options.GatherCharacterCounts {
+				xCount++ // accumulate for adding to the shared count outside of inner loop
+				// NOTE: if the above was incrementing the shared count for '^' under 'mutex' protection
+				//       Decode() runs ~3.5 times slower in debugger
+			}
+		}
+		columnOffsetIntoLine += width
+	}
+
+	if unknownStart >= 0 {
+		unknownRuns = append(unknownRuns, unknownRun{start: unknownStart, end: lineWidth, textPos: lineText.Len(), face: lastFace})
+	}
+
+	text := lineText.String()
+
+	if unknownRuns != nil && r.options.Unknown != nil {
+		if lastFace < 0 {
+			// no characters to go by, so saved from the rows of the first face
+			for i := range unknownRuns {
+				unknownRuns[i].face = 0
+			}
+		}
+		r.options.Unknown.add(unknownRuns, r.faces, buffers.faces, lineWidth, text)
+	}
+
+	if r.options.GatherCharacterCounts {
+		if len(text) > 15 { // simple check that line is valid before processing
+			r.mutex.Lock() // grabing and releasing mutex around following 'specific' loop results in faster execution
+			for i := 0; i < len(text); i++ {
+				r.charCounts[text[i]]++
+			}
+			r.charCounts[BlankCharacter] += uint64(xCount)
+			r.mutex.Unlock()
+		}
+	}
+
+	return text, nil
+}
+
+// glyphAt returns the glyph found at column x of the line, the number of columns it covers and
+// the index of the face it was found in.
+// The faces are tried in order and the first that finds a character wins. A blank column is only
+// taken as blank if no face finds a character there, as a taller face's glyph can start with a
+// column that is blank in the rows of a shorter face.
+func (r *Recognizer) glyphAt(buffers *lineBuffers, lineWidth int, x int) (*searchGlyph, int, int) {
+	var blank *searchGlyph
+	var blankWidth, blankFace int
+
+	for i, f := range r.faces {
+		fl := &buffers.faces[i]
+		var g *searchGlyph
+		var width int
+		if r.options.Binarise {
+			g, width = r.maskGlyph(f, fl.masks[:lineWidth], x)
+		} else {
+			g = r.exactGlyph(f, fl.pixels[:lineWidth*f.Height], lineWidth, x)
+			if g == nil && r.tolerant() {
+				g = r.closestGlyph(f, fl.pixels[:lineWidth*f.Height], lineWidth, x)
+			}
+			if g != nil {
+				width = g.Width
+			}
+		}
+		if g == nil {
+			continue
+		}
+		if g.Character != BlankCharacter {
+			return g, width, i
+		}
+		if blank == nil {
+			blank, blankWidth, blankFace = g, width, i
+		}
+	}
+
+	return blank, blankWidth, blankFace
+}
+
+// exactGlyph returns the first glyph, in priority order, whose pixels are exactly the
+// same as the line's at column x, or nil if there is none.
+// Only the glyphs whose first column has the same hash as the line's are compared, as no other
+// can be the same; when none of them is, glyphAt falls back to comparing every glyph in turn
+// if matching is tolerant.
+func (r *Recognizer) exactGlyph(f *face, lineAsUint32 []uint32, lineWidth int, x int) *searchGlyph {
+	for _, g := range f.hashIndex.lookup(columnHash(lineAsUint32[x*f.Height : (x+1)*f.Height])) {
+		if r.exactMatch(g, lineAsUint32, lineWidth, x) {
+			return g
+		}
+	}
+	return nil
+}
+
+// exactMatch reports whether glyph g has exactly the same pixels as the line at column x.
+func (r *Recognizer) exactMatch(g *searchGlyph, lineAsUint32 []uint32, lineWidth int, x int) bool {
+	height := g.Height
+	if (g.Width + x) > lineWidth {
+		return false
+	}
+	var w = g.Width
+	if r.options.PriorKnowledgeSpeedup {
+		if w > 4 {
+			// (this has been seen to save ~ 1/6th of search time)
+			w = 4 // minimum number of columns that work for fonts used
+		}
+	}
+	linePixels := lineAsUint32[x*height : (x+w)*height]
+	for i, p := range g.Pixels[:w*height] {
+		if p != linePixels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// imageToPixels copies rect of img into a buffer laid out the same as the X11 ZPixmap data.
+func imageToPixels(img image.Image, rect image.Rectangle) ([]byte, int) {
+	rect = rect.Intersect(img.Bounds())
+	stride := rect.Dx() * 4
+	pix := make([]byte, stride*rect.Dy())
+
+	offset := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pix[offset] = uint8(b >> 8)
+			pix[offset+1] = uint8(g >> 8)
+			pix[offset+2] = uint8(r >> 8)
+			offset += 4
+		}
+	}
+
+	return pix, stride
+}
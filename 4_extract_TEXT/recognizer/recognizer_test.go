@@ -0,0 +1,242 @@
+package recognizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	testFontDescription = "../optimised_character_info.json"
+	testFontDir         = "../../2_create_font_PNGs/font_source_bitmaps"
+	testMockFonts       = "../../2_create_font_PNGs/font_character_info.json"
+	testMockFontDir     = "../../2_create_font_PNGs/font_bitmaps/"
+	testMockLine        = "../../3_scroll_window_Mock/sprites/lineWhite18.png"
+	testMockData        = "../../1_mock_data/mock_data.csv"
+
+	testLineWidth  = 532
+	testLineHeight = 18
+)
+
+func readTestPNG(tb testing.TB, fileName string) image.Image {
+	infile, err := os.Open(fileName)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer infile.Close()
+	img, err := png.Decode(infile)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return img
+}
+
+// lineRenderer draws lines of mock data the same way as 3_scroll_window_Mock,
+// as seen through the 532 pixel wide grab of 4_extract_Text.
+type lineRenderer struct {
+	background image.Image
+	glyphs     map[byte]image.Image
+	widths     map[byte]int
+}
+
+func newLineRenderer(tb testing.TB) *lineRenderer {
+	data, err := ioutil.ReadFile(testMockFonts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var fonts []struct {
+		Character    string
+		Width        int
+		FontFileName string
+	}
+	if err := json.Unmarshal(data, &fonts); err != nil {
+		tb.Fatal(err)
+	}
+
+	lr := &lineRenderer{
+		background: readTestPNG(tb, testMockLine),
+		glyphs:     make(map[byte]image.Image),
+		widths:     make(map[byte]int),
+	}
+	for _, f := range fonts {
+		lr.glyphs[f.Character[0]] = readTestPNG(tb, testMockFontDir+f.FontFileName)
+		lr.widths[f.Character[0]] = f.Width
+	}
+	return lr
+}
+
+func (lr *lineRenderer) textWidth(text string) int {
+	var width int
+	for i := 0; i < len(text); i++ {
+		width += lr.widths[text[i]]
+	}
+	return width
+}
+
+func (lr *lineRenderer) text(dst *image.RGBA, x int, text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		draw.Draw(dst, image.Rect(x, 0, x+lr.widths[c], testLineHeight), lr.glyphs[c], image.Point{}, draw.Src)
+		x += lr.widths[c]
+	}
+}
+
+// render returns a mock data line, e.g. "00:00:00,1,4,20,1", as pixels in the X11 ZPixmap order.
+func (lr *lineRenderer) render(line string) []byte {
+	dst := image.NewRGBA(image.Rect(0, 0, testLineWidth, testLineHeight))
+	draw.Draw(dst, dst.Bounds(), lr.background, image.Point{}, draw.Src)
+
+	// positions are those of the mock window, less the 1 pixel the grab starts in by
+	parts := strings.Split(line, ",")
+	lr.text(dst, 1, parts[0])
+	for _, x := range []int{106, 203, 315, 442} {
+		lr.text(dst, x-1, "|")
+	}
+	lr.text(dst, 203-2-lr.textWidth(parts[1]), parts[1])
+	lr.text(dst, 315-2-lr.textWidth(parts[2]), parts[2])
+	lr.text(dst, 442-2-lr.textWidth(parts[3]), parts[3])
+	lr.text(dst, 531-lr.textWidth(parts[4]), parts[4])
+
+	pix, _ := imageToPixels(dst, dst.Bounds())
+	return pix
+}
+
+func readMockLines(tb testing.TB, from int, to int) []string {
+	file, err := os.Open(testMockData)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for n := 0; scanner.Scan() && n < to; n++ {
+		if n >= from {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	return lines
+}
+
+// newTestRecognizer loads the font set used by 4_extract_Text, in the order of extractionList.
+func newTestRecognizer(tb testing.TB, options Options, extractionList string) *Recognizer {
+	fonts, err := LoadFontSet(testFontDescription, testFontDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	r, err := New(fonts.Prioritize([]byte(extractionList)), options)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+// tunedOrder is the extractionList of 4_extract_Text, reversedOrder is the worst case for the search.
+const (
+	tunedOrder    = "^|01453.:28976,%+-"
+	reversedOrder = "-+%,67982:.35410|^"
+)
+
+var testLineRect = image.Rect(0, 0, testLineWidth, testLineHeight)
+
+// testPage renders one screen full of mock data lines.
+func testPage(tb testing.TB) [][]byte {
+	lr := newLineRenderer(tb)
+	var page [][]byte
+	for _, line := range readMockLines(tb, 20000, 20050) {
+		page = append(page, lr.render(line))
+	}
+	return page
+}
+
+func TestSearchOrder(t *testing.T) {
+	lr := newLineRenderer(t)
+	for _, options := range []Options{{}, {PriorKnowledgeSpeedup: true}, {Binarise: true, DetectBackground: true}} {
+		tuned := newTestRecognizer(t, options, tunedOrder)
+		reversed := newTestRecognizer(t, options, reversedOrder)
+		for _, line := range readMockLines(t, 0, 500) {
+			pix := lr.render(line)
+			got, err := tuned.Line(pix, testLineWidth*4, testLineRect)
+			if err != nil || got != line {
+				t.Fatalf("%+v tuned : %q gave %q, %v", options, line, got, err)
+			}
+			got, err = reversed.Line(pix, testLineWidth*4, testLineRect)
+			if err != nil || got != line {
+				t.Fatalf("%+v reversed : %q gave %q, %v", options, line, got, err)
+			}
+		}
+	}
+}
+
+// benchmarkPage decodes a page, to compare with BenchmarkPageOriginal.
+func benchmarkPage(b *testing.B, options Options, extractionList string) {
+	r := newTestRecognizer(b, options, extractionList)
+	page := testPage(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pix := range page {
+			if _, err := r.Decode(pix, testLineWidth*4, testLineRect); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkPageTuned(b *testing.B) {
+	benchmarkPage(b, Options{PriorKnowledgeSpeedup: true}, tunedOrder)
+}
+
+func BenchmarkPageReversed(b *testing.B) {
+	benchmarkPage(b, Options{PriorKnowledgeSpeedup: true}, reversedOrder)
+}
+
+func BenchmarkPageBinarised(b *testing.B) {
+	benchmarkPage(b, Options{Binarise: true, DetectBackground: true}, tunedOrder)
+}
+
+func TestSpaceWidth(t *testing.T) {
+	fonts := &FontSet{
+		Faces: []Face{{Height: 3}},
+		Glyphs: []Glyph{
+			glyphFromRows(BlankCharacter, "", ".", ".", "."),
+			glyphFromRows('a', "", "##", "#.", "##"),
+			glyphFromRows('b', "", "#.", "##", "#."),
+		},
+	}
+	// 2 blank columns before "ababab", then 1, 3, 2, 4 and 6 between the characters, and 3 after
+	pix, stride := drawRows(
+		"..##.#....##..#.....##......#....",
+		"..#..##...#...##....#.......##...",
+		"..##.#....##..#.....##......#....",
+	)
+	rect := image.Rect(0, 0, stride/4, 3)
+
+	tests := []struct {
+		spaceWidth int
+		space      string
+		want       string
+	}{
+		{0, "", "ababab"},      // gaps left out
+		{3, "", "ab ab a b"},   // runs of 3 or more blank columns, not 1 or 2
+		{4, "|", "abab|a|b"},   // with a separator in place of the space
+		{5, "", "ababa b"},     // only the widest gap
+		{7, "", "ababab"},      // no gap wide enough
+		{-1, "", "ab a b a b"}, // half the average width of a character, at least 2 columns
+	}
+	for _, test := range tests {
+		r, err := New(fonts, Options{SpaceWidth: test.spaceWidth, Space: test.space})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := r.Decode(pix, stride, rect); err != nil || got != test.want {
+			t.Errorf("SpaceWidth %v : got %q, %v, want %q", test.spaceWidth, got, err, test.want)
+		}
+	}
+}
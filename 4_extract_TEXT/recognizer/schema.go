@@ -0,0 +1,179 @@
+package recognizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Field types that a schema can check the text of a field against.
+const (
+	FieldText    = "text" // anything, the same as no type
+	FieldTime    = "time" // e.g. 23:59:59 or 23:59:59.250
+	FieldInt     = "int"
+	FieldDecimal = "decimal"
+	FieldPercent = "percent" // a decimal followed by '%'
+)
+
+var fieldTypePatterns = map[string]*regexp.Regexp{
+	FieldText:    nil,
+	FieldTime:    regexp.MustCompile(`^[0-9]{2}:[0-9]{2}:[0-9]{2}([.,][0-9]+)?$`),
+	FieldInt:     regexp.MustCompile(`^[-+]?[0-9]+$`),
+	FieldDecimal: regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`),
+	FieldPercent: regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)%$`),
+}
+
+// Field is one column of the rows described by a Schema.
+type Field struct {
+	Name    string
+	Type    string // one of the Field... types, "" for text
+	Pattern string `json:",omitempty"` // a regular expression the whole field must also match
+
+	pattern *regexp.Regexp
+}
+
+// Schema describes the rows of the table being scraped: which characters separate
+// its fields, what each field must look like, and how the fields are written out.
+type Schema struct {
+	Separators string // each of these characters divides one field from the next, e.g. "|"
+	Delimiter  string // written between the fields of a converted row, e.g. ","
+	Fields     []Field
+}
+
+// DefaultSchema is the row layout of the example mock data, used when no schema file is given:
+// 5 fields divided by '|', the first being a time, written out comma separated.
+func DefaultSchema() *Schema {
+	s := &Schema{
+		Separators: "|",
+		Delimiter:  ",",
+		Fields: []Field{
+			{Name: "Time", Type: FieldTime},
+			{Name: "Index"},
+			{Name: "Floor"},
+			{Name: "Door"},
+			{Name: "State"},
+		},
+	}
+	s.compile() // can not fail
+	return s
+}
+
+// LoadSchema reads a schema from a JSON file, e.g.
+//
+//	{"Separators": "|", "Delimiter": ",", "Fields": [{"Name": "Time", "Type": "time"}, {"Name": "Value", "Type": "decimal"}]}
+func LoadSchema(fileName string) (*Schema, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("schema %v : %v", fileName, err)
+	}
+	if err = s.compile(); err != nil {
+		return nil, fmt.Errorf("schema %v : %v", fileName, err)
+	}
+	return s, nil
+}
+
+// compile checks the schema and prepares the patterns of its fields.
+func (s *Schema) compile() error {
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("no 'Fields'")
+	}
+	if len(s.Fields) > 1 && s.Separators == "" {
+		return fmt.Errorf("'Separators' is needed to tell %v fields apart", len(s.Fields))
+	}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if f.Name == "" {
+			return fmt.Errorf("field %v has no 'Name'", i+1)
+		}
+		if f.Type == "" {
+			f.Type = FieldText
+		}
+		if _, ok := fieldTypePatterns[f.Type]; !ok {
+			return fmt.Errorf("field %v 'Type' %q is not one of text, time, int, decimal or percent", f.Name, f.Type)
+		}
+		if f.Pattern != "" {
+			var err error
+			if f.pattern, err = regexp.Compile("^(?:" + f.Pattern + ")$"); err != nil {
+				return fmt.Errorf("field %v 'Pattern' : %v", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Split divides the decoded characters of a line into the fields of the schema and checks each one.
+// The errors are the ConversionError codes the extractor has always reported: a blank line,
+// a line of nothing but separators, the wrong number of fields, or a time that is not a time.
+// Any other field that does not match its type or pattern gives ConversionErrorFieldInvalid.
+func (s *Schema) Split(lineText string) ([]string, error) {
+	if len(lineText) == 0 {
+		return nil, &ConversionError{Code: ConversionErrorBlankLine}
+	}
+	if len(lineText) == len(s.Fields)-1 && strings.Trim(lineText, s.Separators) == "" {
+		return nil, &ConversionError{Code: ConversionErrorOnlyFourDividers, Detail: "found only " + strconv.Itoa(len(lineText)) + " dividers", Text: lineText}
+	}
+
+	parts := splitAny(lineText, s.Separators)
+	if len(parts) != len(s.Fields) {
+		return nil, &ConversionError{Code: ConversionErrorWrongNumberOfSections, Detail: "field count " + strconv.Itoa(len(parts)), Text: lineText}
+	}
+
+	for i, f := range s.Fields {
+		if typePattern := fieldTypePatterns[f.Type]; typePattern != nil && !typePattern.MatchString(parts[i]) {
+			code := ConversionErrorFieldInvalid
+			if f.Type == FieldTime {
+				code = ConversionErrorTimeFormatWrong
+			}
+			return nil, &ConversionError{Code: code, Detail: fmt.Sprintf("%v %q is not %v", f.Name, parts[i], f.Type), Text: lineText}
+		}
+		if f.pattern != nil && !f.pattern.MatchString(parts[i]) {
+			return nil, &ConversionError{Code: ConversionErrorFieldInvalid, Detail: fmt.Sprintf("%v %q does not match %v", f.Name, parts[i], f.Pattern), Text: lineText}
+		}
+	}
+
+	// Apply any transformations to any fields here ...
+
+	return parts, nil
+}
+
+// Row is one converted line of the table.
+type Row struct {
+	Text   string   // the fields joined by the schema's Delimiter
+	Fields []string // one for each of the schema's Fields
+}
+
+// Row applies the business logic to re-formulate the decoded characters
+// into proper numerical and data format.
+func (s *Schema) Row(lineText string) (Row, error) {
+	parts, err := s.Split(lineText)
+	if err != nil {
+		return Row{}, err
+	}
+	return Row{Text: strings.Join(parts, s.Delimiter), Fields: parts}, nil
+}
+
+// Format is Row, returning only the text of the row.
+func (s *Schema) Format(lineText string) (string, error) {
+	row, err := s.Row(lineText)
+	return row.Text, err
+}
+
+// splitAny splits text at every one of the separator characters.
+func splitAny(text string, separators string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if strings.IndexByte(separators, text[i]) >= 0 {
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
@@ -0,0 +1,141 @@
+package recognizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFieldTypes(t *testing.T) {
+	tests := []struct {
+		fieldType string
+		value     string
+		want      int // ConversionGood, or the code of the error
+	}{
+		{FieldTime, "00:00:00", ConversionGood},
+		{FieldTime, "23:59:59.250", ConversionGood},
+		{FieldTime, "23:59:59,5", ConversionGood},
+		{FieldTime, "99:99:99", ConversionGood}, // the digits are not checked as a time of day, as before
+		// the extractor used to only check for colons at [2] and [5], so took these as times
+		{FieldTime, "ab:cd:ef", ConversionErrorTimeFormatWrong},
+		{FieldTime, "00:00:", ConversionErrorTimeFormatWrong},
+		{FieldTime, "00:00:0", ConversionErrorTimeFormatWrong},
+		{FieldTime, "00:00:00:00", ConversionErrorTimeFormatWrong},
+		{FieldTime, "00:00:00.", ConversionErrorTimeFormatWrong},
+		{FieldTime, "00:00:00 ", ConversionErrorTimeFormatWrong},
+		// and stopped with an index out of range on these
+		{FieldTime, "0:00", ConversionErrorTimeFormatWrong},
+		{FieldTime, "", ConversionErrorTimeFormatWrong},
+
+		{FieldInt, "0", ConversionGood},
+		{FieldInt, "-12", ConversionGood},
+		{FieldInt, "+7", ConversionGood},
+		{FieldInt, "007", ConversionGood},
+		{FieldInt, "1.0", ConversionErrorFieldInvalid},
+		{FieldInt, "1 2", ConversionErrorFieldInvalid},
+		{FieldInt, "-", ConversionErrorFieldInvalid},
+		{FieldInt, "", ConversionErrorFieldInvalid},
+
+		{FieldDecimal, "1", ConversionGood},
+		{FieldDecimal, "1.", ConversionGood},
+		{FieldDecimal, "-0.25", ConversionGood},
+		{FieldDecimal, ".5", ConversionGood},
+		{FieldDecimal, ".", ConversionErrorFieldInvalid},
+		{FieldDecimal, "1.2.3", ConversionErrorFieldInvalid},
+		{FieldDecimal, "1e3", ConversionErrorFieldInvalid},
+		{FieldDecimal, "1,5", ConversionErrorFieldInvalid},
+
+		{FieldPercent, "50%", ConversionGood},
+		{FieldPercent, "-2.5%", ConversionGood},
+		{FieldPercent, ".5%", ConversionGood},
+		{FieldPercent, "50", ConversionErrorFieldInvalid},
+		{FieldPercent, "%", ConversionErrorFieldInvalid},
+		{FieldPercent, "50 %", ConversionErrorFieldInvalid},
+
+		{FieldText, "", ConversionGood},
+		{FieldText, "anything: at all, 1.5%", ConversionGood},
+		{"", "no type is text", ConversionGood},
+	}
+	for _, test := range tests {
+		schema := &Schema{Separators: "|", Delimiter: ",", Fields: []Field{{Name: "Label"}, {Name: "Value", Type: test.fieldType}}}
+		if err := schema.compile(); err != nil {
+			t.Fatal(err)
+		}
+		row, err := schema.Row("label|" + test.value)
+		if got := ErrorCode(err); got != test.want {
+			t.Errorf("%v %q : got %v (%v), want %v", test.fieldType, test.value, got, err, test.want)
+			continue
+		}
+		if err == nil && (row.Text != "label,"+test.value || len(row.Fields) != 2 || row.Fields[1] != test.value) {
+			t.Errorf("%v %q : got %+v", test.fieldType, test.value, row)
+		}
+	}
+}
+
+func TestSchemaSplit(t *testing.T) {
+	pattern := &Schema{Separators: "|", Fields: []Field{{Name: "State", Type: FieldInt, Pattern: "[01]"}, {Name: "Note"}}}
+	if err := pattern.compile(); err != nil {
+		t.Fatal(err)
+	}
+	spaces := &Schema{Separators: " |", Delimiter: "\t", Fields: []Field{{Name: "A"}, {Name: "B"}, {Name: "C"}}}
+	if err := spaces.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		schema *Schema
+		line   string
+		want   int
+		text   string
+	}{
+		{DefaultSchema(), "00:00:17|1|4|20|1", ConversionGood, "00:00:17,1,4,20,1"},
+		{DefaultSchema(), "", ConversionErrorBlankLine, ""},
+		{DefaultSchema(), "||||", ConversionErrorOnlyFourDividers, ""},
+		{DefaultSchema(), "00:00:17|1|4|20", ConversionErrorWrongNumberOfSections, ""},
+		{DefaultSchema(), "00:00:17|1|4|20|1|", ConversionErrorWrongNumberOfSections, ""},
+		{DefaultSchema(), "00:0017|1|4|20|1", ConversionErrorTimeFormatWrong, ""},
+		{pattern, "1|on", ConversionGood, "1on"},
+		{pattern, "2|on", ConversionErrorFieldInvalid, ""},
+		{pattern, "|", ConversionErrorOnlyFourDividers, ""},
+		{spaces, "a b|c", ConversionGood, "a\tb\tc"},
+	}
+	for _, test := range tests {
+		row, err := test.schema.Row(test.line)
+		if got := ErrorCode(err); got != test.want || row.Text != test.text {
+			t.Errorf("%q : got %q, %v, want %q, code %v", test.line, row.Text, err, test.text, test.want)
+		}
+		if err != nil && test.line != "" && err.(*ConversionError).Text != test.line {
+			t.Errorf("%q : the error has the text %q", test.line, err.(*ConversionError).Text)
+		}
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recognizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "schema.json")
+
+	if _, err = LoadSchema("../configuration/schema.json"); err != nil {
+		t.Errorf("configuration/schema.json : %v", err)
+	}
+
+	for _, schema := range []string{
+		`{"Separators": "|", "Fields": [`,
+		`{"Separators": "|", "Fields": []}`,
+		`{"Fields": [{"Name": "A"}, {"Name": "B"}]}`,
+		`{"Separators": "|", "Fields": [{"Type": "int"}]}`,
+		`{"Separators": "|", "Fields": [{"Name": "A", "Type": "date"}]}`,
+		`{"Separators": "|", "Fields": [{"Name": "A", "Pattern": "[0-"}]}`,
+	} {
+		if err = ioutil.WriteFile(fileName, []byte(schema), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = LoadSchema(fileName); err == nil {
+			t.Errorf("%v : loaded with no error", schema)
+		}
+	}
+}
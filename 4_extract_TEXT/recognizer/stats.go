@@ -0,0 +1,116 @@
+package recognizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/atomicfile"
+)
+
+// CharacterStats is a running total of how often each character has been found, kept
+// in a file across runs so that the glyph search order can be learned rather than hand tuned.
+type CharacterStats struct {
+	Runs   int               `json:"Runs"`
+	Counts map[string]uint64 `json:"Counts"`
+
+	// SearchOrder is Order() when the stats were saved, for reading, it is not loaded back
+	SearchOrder string `json:"SearchOrder,omitempty"`
+}
+
+// LoadCharacterStats reads the stats saved by Save. A file that does not exist yet
+// gives empty stats, so that the first run can start the file.
+func LoadCharacterStats(fileName string) (*CharacterStats, error) {
+	stats := &CharacterStats{Counts: make(map[string]uint64)}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, stats); err != nil {
+		return nil, fmt.Errorf("character stats file %v : %v", fileName, err)
+	}
+	stats.SearchOrder = ""
+	if stats.Counts == nil {
+		stats.Counts = make(map[string]uint64)
+	}
+	for c := range stats.Counts {
+		if len(c) != 1 {
+			return nil, fmt.Errorf("character stats file %v : %q is not ONE character", fileName, c)
+		}
+	}
+	return stats, nil
+}
+
+// Add counts one run, as returned by Recognizer.CharacterCounts().
+func (s *CharacterStats) Add(counts [256]uint64) {
+	s.Runs++
+	for i, n := range counts {
+		if n > 0 {
+			s.Counts[string([]byte{byte(i)})] += n
+		}
+	}
+}
+
+// Save writes the stats, with the order they give, to a temporary file that then replaces
+// fileName, so that an interrupted save does not lose the totals of earlier runs.
+func (s *CharacterStats) Save(fileName string) error {
+	s.SearchOrder = string(s.Order())
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(fileName, append(data, '\n'))
+}
+
+// Order returns the characters seen, most frequent first (ties in character order).
+func (s *CharacterStats) Order() []byte {
+	order := make([]byte, 0, len(s.Counts))
+	for c := range s.Counts {
+		order = append(order, c[0])
+	}
+	sort.Slice(order, func(a, b int) bool {
+		na, nb := s.Counts[string(order[a:a+1])], s.Counts[string(order[b:b+1])]
+		if na != nb {
+			return na > nb
+		}
+		return order[a] < order[b]
+	})
+	return order
+}
+
+// RecordSearchOrder re-arranges the entries of the font description file into the
+// given order and numbers them with a 'SearchOrder' field, so that LoadFontSet
+// returns the glyphs in that order from then on.
+// Characters not in order keep their relative position, after all the listed ones.
+func RecordSearchOrder(descriptionFile string, order []byte) error {
+	entries, err := readFontDescription(descriptionFile)
+	if err != nil {
+		return err
+	}
+
+	var rank [256]int
+	for i := len(order) - 1; i >= 0; i-- { // so the first of any repeats wins
+		rank[order[i]] = i + 1
+	}
+	characterRank := func(entry map[string]json.RawMessage) int {
+		var c string
+		if json.Unmarshal(entry["Character"], &c) != nil || len(c) != 1 || rank[c[0]] == 0 {
+			return len(order) + 1
+		}
+		return rank[c[0]]
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return characterRank(entries[a]) < characterRank(entries[b])
+	})
+
+	for i, entry := range entries {
+		entry["SearchOrder"] = json.RawMessage(fmt.Sprint(i + 1))
+	}
+
+	return writeFontDescription(descriptionFile, entries)
+}
@@ -0,0 +1,124 @@
+package recognizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyFile copies fileName into dir, returning the path of the copy.
+func copyFile(t *testing.T, fileName string, dir string) string {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, filepath.Base(fileName))
+	if err = ioutil.WriteFile(copied, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return copied
+}
+
+func TestCharacterStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recognizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "character_stats.json")
+
+	stats, err := LoadCharacterStats(fileName)
+	if err != nil || stats.Runs != 0 || len(stats.Counts) != 0 {
+		t.Fatalf("no file : got %+v, %v, want empty stats", stats, err)
+	}
+
+	var counts [256]uint64
+	counts['1'], counts['2'], counts['^'] = 5, 7, 7
+	stats.Add(counts)
+	counts = [256]uint64{}
+	counts['1'], counts[','] = 3, 1
+	stats.Add(counts)
+	if err = stats.Save(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCharacterStats(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Runs != 2 || len(loaded.Counts) != 4 || loaded.Counts["1"] != 8 || loaded.Counts[","] != 1 {
+		t.Errorf("loaded %+v, want 2 runs of 4 characters", loaded)
+	}
+	// most frequent first, ties in character order
+	if got, want := string(loaded.Order()), "12^,"; got != want {
+		t.Errorf("Order() = %q, want %q", got, want)
+	}
+	if data, _ := ioutil.ReadFile(fileName); !strings.Contains(string(data), `"SearchOrder": "12^,"`) {
+		t.Errorf("the saved file has no search order :\n%s", data)
+	}
+
+	for name, data := range map[string]string{
+		"not json":        `{"Runs": 1, "Counts": `,
+		"not a character": `{"Runs": 1, "Counts": {"12": 3}}`,
+	} {
+		if err = ioutil.WriteFile(fileName, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = LoadCharacterStats(fileName); err == nil {
+			t.Errorf("%v : loaded with no error", name)
+		}
+	}
+}
+
+func TestRecordSearchOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recognizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	descriptionFile := copyFile(t, testFontDescription, dir)
+
+	fonts, err := LoadFontSet(descriptionFile, testFontDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fonts.SearchOrder != nil {
+		t.Fatalf("the test font description already has a search order %q", fonts.SearchOrder)
+	}
+	var unlisted []byte // in the order of the file
+	for _, g := range fonts.Glyphs {
+		if g.Character != '9' && g.Character != '0' && g.Character != '^' {
+			unlisted = append(unlisted, g.Character)
+		}
+	}
+
+	if err = RecordSearchOrder(descriptionFile, []byte("90^9")); err != nil {
+		t.Fatal(err)
+	}
+	fonts, err = LoadFontSet(descriptionFile, testFontDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the listed characters first, then the rest as they were
+	want := "90^" + string(unlisted)
+	if string(fonts.SearchOrder) != want {
+		t.Errorf("SearchOrder = %q, want %q", fonts.SearchOrder, want)
+	}
+	var got []byte
+	for _, g := range fonts.Glyphs {
+		got = append(got, g.Character)
+	}
+	if string(got) != want {
+		t.Errorf("glyphs in the order %q, want %q", got, want)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(files) > 0 {
+		t.Errorf("temporary files left behind : %v", files)
+	}
+
+	if err = RecordSearchOrder(filepath.Join(dir, "missing.json"), []byte("0")); err == nil {
+		t.Errorf("no error for a missing font description file")
+	}
+}
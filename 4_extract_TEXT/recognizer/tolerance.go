@@ -0,0 +1,64 @@
+package recognizer
+
+// tolerant reports whether the tolerant matching mode is turned on.
+func (r *Recognizer) tolerant() bool {
+	return r.options.ColourTolerance > 0 || r.options.MaxMismatchedPixels > 0
+}
+
+// closeColour reports whether each colour channel of two 0x00RRGGBB pixels is within tolerance.
+func closeColour(a uint32, b uint32, tolerance int) bool {
+	for shift := uint(0); shift < 24; shift += 8 {
+		d := int((a>>shift)&0xFF) - int((b>>shift)&0xFF)
+		if d > tolerance || d < -tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// closestGlyph returns the glyph of face f that best matches the line at column x within the
+// configured tolerance, or nil if there is none.
+// Fewest mismatched pixels wins, then the widest glyph (as it is matched on more
+// pixels), then the glyph earliest in priority order.
+func (r *Recognizer) closestGlyph(f *face, lineAsUint32 []uint32, lineWidth int, x int) *searchGlyph {
+	height := f.Height
+	tolerance := r.options.ColourTolerance
+	maxMismatched := r.options.MaxMismatchedPixels
+
+	var best *searchGlyph
+	var bestMismatched int
+
+	for b := range f.glyphs {
+		g := &f.glyphs[b]
+		if (g.Width + x) > lineWidth {
+			continue
+		}
+
+		// no point looking further than the best so far
+		limit := maxMismatched
+		if best != nil && bestMismatched < limit {
+			limit = bestMismatched
+		}
+
+		mismatched := 0
+		linePixels := lineAsUint32[x*height : (x+g.Width)*height]
+		for i, p := range g.Pixels {
+			if p != linePixels[i] && !closeColour(p, linePixels[i], tolerance) {
+				mismatched++
+				if mismatched > limit {
+					break
+				}
+			}
+		}
+		if mismatched > limit {
+			continue
+		}
+
+		if best == nil || mismatched < bestMismatched || (mismatched == bestMismatched && g.Width > best.Width) {
+			best = g
+			bestMismatched = mismatched
+		}
+	}
+
+	return best
+}
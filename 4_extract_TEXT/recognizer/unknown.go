@@ -0,0 +1,295 @@
+package recognizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/atomicfile"
+)
+
+// UnknownMarker is put in the text context of an unknown glyph where its pixels were.
+const UnknownMarker = "[?]"
+
+const (
+	maxUnknownWidth    = 30 // the widest glyph LoadFontSet accepts
+	maxUnknownContexts = 5
+)
+
+// UnknownGlyph is a run of pixel columns that no glyph matched, as saved in a capture directory.
+type UnknownGlyph struct {
+	Name        string   // hash of the pixels, also the name of its files
+	Width       int      // columns of pixels
+	Height      int      // rows of pixels, the height of Face
+	LineYOffset int      // rows down from the top of a line to where the pixels start
+	Face        string   `json:",omitempty"` // the face whose rows were saved
+	Count       int      // times seen
+	Contexts    []string // text of the first few lines it was seen in, with UnknownMarker where it was
+	Label       string   `json:",omitempty"` // the character given by LabelUnknownGlyph
+}
+
+// PNGFile is the name of the .png file holding the pixels.
+func (u *UnknownGlyph) PNGFile() string { return u.Name + ".png" }
+
+// LinePNGFile is the name of the .png file holding the whole line it was first seen in.
+func (u *UnknownGlyph) LinePNGFile() string { return u.Name + "_line.png" }
+
+func (u *UnknownGlyph) infoFile() string { return u.Name + ".json" }
+
+// UnknownGlyphs collects the unknown glyphs found by a Recognizer into a directory,
+// saving each different one once, see Options.Unknown. They are only held in memory until
+// Flush saves them, so that decoding is not held up by the writing of files.
+// It is safe for concurrent use by multiple goroutines.
+type UnknownGlyphs struct {
+	dir    string
+	mutex  sync.Mutex
+	glyphs map[string]*UnknownGlyph
+	dirty  map[string]bool          // glyphs whose count or contexts have changed since the last Flush
+	pixels map[string]unknownPixels // of the glyphs not yet saved
+	err    error                    // the first save that failed
+
+	flushMutex sync.Mutex // so that the files of one Flush are not written over by another's
+}
+
+// unknownPixels is what is saved of an unknown glyph the first time it is seen, a column at a time.
+type unknownPixels struct {
+	glyph         []uint32
+	line          []uint32 // the whole line, in the rows of the glyph
+	width, height int
+	lineWidth     int
+}
+
+// NewUnknownGlyphs creates dir if need be and reads the unknown glyphs already saved in it,
+// so that glyphs captured by earlier runs are not saved again.
+func NewUnknownGlyphs(dir string) (*UnknownGlyphs, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	glyphs, err := ReadUnknownGlyphs(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := &UnknownGlyphs{dir: dir, glyphs: make(map[string]*UnknownGlyph), dirty: make(map[string]bool), pixels: make(map[string]unknownPixels)}
+	for _, u := range glyphs {
+		c.glyphs[u.Name] = u
+	}
+	return c, nil
+}
+
+// ReadUnknownGlyphs returns the unknown glyphs saved in dir, most often seen first.
+func ReadUnknownGlyphs(dir string) ([]*UnknownGlyph, error) {
+	infoFiles, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var glyphs []*UnknownGlyph
+	for _, infoFile := range infoFiles {
+		data, err := ioutil.ReadFile(infoFile)
+		if err != nil {
+			return nil, err
+		}
+		u := &UnknownGlyph{}
+		if err = json.Unmarshal(data, u); err != nil {
+			return nil, fmt.Errorf("unknown glyph %v : %v", infoFile, err)
+		}
+		glyphs = append(glyphs, u)
+	}
+	sort.SliceStable(glyphs, func(a, b int) bool {
+		return glyphs[a].Count > glyphs[b].Count
+	})
+	return glyphs, nil
+}
+
+// Dir is the directory the glyphs are saved in.
+func (c *UnknownGlyphs) Dir() string { return c.dir }
+
+// Len is the number of different unknown glyphs in the directory.
+func (c *UnknownGlyphs) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.glyphs)
+}
+
+// Flush saves the glyphs seen for the first time since the last Flush, and the counts and
+// contexts of those seen again, and returns the first error from saving any of the glyphs.
+func (c *UnknownGlyphs) Flush() error {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	// take what is to be saved, so that the files can be written without holding up add
+	c.mutex.Lock()
+	pixels, dirty := c.pixels, c.dirty
+	c.pixels, c.dirty = make(map[string]unknownPixels), make(map[string]bool)
+	infos := make([]UnknownGlyph, 0, len(dirty))
+	for name := range dirty {
+		u := *c.glyphs[name]
+		u.Contexts = append([]string(nil), u.Contexts...)
+		infos = append(infos, u)
+	}
+	c.mutex.Unlock()
+
+	var err error
+	for name, p := range pixels {
+		u := UnknownGlyph{Name: name}
+		if e := savePixelsPNG(filepath.Join(c.dir, u.PNGFile()), p.glyph, p.width, p.height); e != nil && err == nil {
+			err = e
+		}
+		if e := savePixelsPNG(filepath.Join(c.dir, u.LinePNGFile()), p.line, p.lineWidth, p.height); e != nil && err == nil {
+			err = e
+		}
+	}
+	for i := range infos {
+		if e := c.saveInfo(&infos[i]); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return c.err
+}
+
+func (c *UnknownGlyphs) saveInfo(u *UnknownGlyph) error {
+	data, err := json.MarshalIndent(u, "", "    ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(c.dir, u.infoFile()), append(data, '\n'))
+}
+
+// unknownRun is where, in a line being decoded, columns start..end-1 matched no glyph.
+type unknownRun struct {
+	start, end int
+	textPos    int // length of the decoded text before the run
+	face       int // the face whose rows are saved, that of the characters next to the run
+}
+
+// add records the unknown runs of one line, from the rows of each run's face in lines.
+// Only the pixels of glyphs not seen before are copied, and nothing is saved until Flush.
+func (c *UnknownGlyphs) add(runs []unknownRun, faces []*face, lines []faceLine, lineWidth int, text string) {
+	names := make([]string, len(runs))
+	for i, run := range runs {
+		if run.end-run.start > maxUnknownWidth {
+			continue // e.g. a line in another colour, which is no use as a glyph
+		}
+		height := faces[run.face].Height
+		lineAsUint32 := lines[run.face].pixels
+		h := fnvOffsetBasis
+		for x := run.start; x < run.end; x++ {
+			h = (h ^ columnHash(lineAsUint32[x*height:(x+1)*height])) * fnvPrime
+		}
+		names[i] = fmt.Sprintf("%016x", h)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, run := range runs {
+		name := names[i]
+		if name == "" {
+			continue
+		}
+		u, ok := c.glyphs[name]
+		if !ok {
+			f := faces[run.face]
+			lineAsUint32 := lines[run.face].pixels[:lineWidth*f.Height]
+			u = &UnknownGlyph{Name: name, Width: run.end - run.start, Height: f.Height, LineYOffset: f.YOffset, Face: f.Name}
+			c.glyphs[name] = u
+			c.pixels[name] = unknownPixels{
+				glyph:     append([]uint32(nil), lineAsUint32[run.start*f.Height:run.end*f.Height]...),
+				line:      append([]uint32(nil), lineAsUint32...),
+				width:     u.Width,
+				height:    u.Height,
+				lineWidth: lineWidth,
+			}
+		}
+		u.Count++
+		if len(u.Contexts) < maxUnknownContexts {
+			u.Contexts = append(u.Contexts, markUnknown(text, runs, i))
+		}
+		c.dirty[name] = true
+	}
+}
+
+// markUnknown returns text with UnknownMarker where runs[this] was, and '?' for any other run.
+func markUnknown(text string, runs []unknownRun, this int) string {
+	var s strings.Builder
+	var pos int
+	for i, run := range runs {
+		s.WriteString(text[pos:run.textPos])
+		pos = run.textPos
+		if i == this {
+			s.WriteString(UnknownMarker)
+		} else {
+			s.WriteByte('?')
+		}
+	}
+	s.WriteString(text[pos:])
+	return s.String()
+}
+
+// savePixelsPNG saves pixels, held a column at a time as 0x00RRGGBB, as a .png file.
+func savePixelsPNG(fileName string, pixels []uint32, width int, height int) error {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			p := pixels[x*height+y]
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(p >> 16), G: uint8(p >> 8), B: uint8(p), A: 0xFF})
+		}
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LabelUnknownGlyph copies the pixels of the unknown glyph u (of face u.Face), from the capture directory dir,
+// into fontDir and appends it to the font description file as character, so that the
+// next font set loaded can find it.
+func LabelUnknownGlyph(dir string, u *UnknownGlyph, character byte, descriptionFile string, fontDir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, u.PNGFile()))
+	if err != nil {
+		return err
+	}
+	fontFile := "captured_" + u.PNGFile()
+	if err = ioutil.WriteFile(filepath.Join(fontDir, fontFile), data, 0644); err != nil {
+		return err
+	}
+
+	err = AppendFontEntry(descriptionFile, FontEntry{
+		Character:   string([]byte{character}),
+		Width:       u.Width,
+		Height:      u.Height,
+		XOffset:     0,
+		YOffset:     0,
+		LineYOffset: u.LineYOffset,
+		FileName:    fontFile,
+		Face:        u.Face,
+	})
+	if err != nil {
+		return err
+	}
+
+	u.Label = string([]byte{character})
+	info, err := json.MarshalIndent(u, "", "    ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(dir, u.infoFile()), append(info, '\n'))
+}
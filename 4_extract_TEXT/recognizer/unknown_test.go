@@ -0,0 +1,240 @@
+package recognizer
+
+import (
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// drawRows returns the pixels of rows, '#' for white and anything else for black, in the X11
+// ZPixmap order, and the stride of them.
+func drawRows(rows ...string) ([]byte, int) {
+	stride := len(rows[0]) * 4
+	pix := make([]byte, stride*len(rows))
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			if row[x] == '#' {
+				copy(pix[y*stride+x*4:], []byte{0xFF, 0xFF, 0xFF, 0})
+			}
+		}
+	}
+	return pix, stride
+}
+
+// glyphFromRows is the glyph of character in face drawn by rows, as drawRows.
+func glyphFromRows(character byte, face string, rows ...string) Glyph {
+	g := Glyph{Character: character, Face: face, Width: len(rows[0]), Height: len(rows)}
+	for x := 0; x < g.Width; x++ {
+		for _, row := range rows {
+			var p uint32
+			if row[x] == '#' {
+				p = 0xFFFFFF
+			}
+			g.Pixels = append(g.Pixels, p)
+		}
+	}
+	return g
+}
+
+// readUnknownPixels returns the pixels of the .png file of u, a column at a time.
+func readUnknownPixels(t *testing.T, dir string, u *UnknownGlyph) []uint32 {
+	img := readTestPNG(t, filepath.Join(dir, u.PNGFile()))
+	var pixels []uint32
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, (r>>8)<<16|(g>>8)<<8|b>>8)
+		}
+	}
+	return pixels
+}
+
+func TestUnknownGlyphsOfEachFace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recognizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 'a' is in the top 3 rows of a line, 'b' and the blank column in the bottom 3
+	fonts := &FontSet{
+		Faces: []Face{{Name: "top", Height: 3, YOffset: 0}, {Name: "bottom", Height: 3, YOffset: 3}},
+		Glyphs: []Glyph{
+			glyphFromRows('a', "top", "##", "#.", "##"),
+			glyphFromRows(BlankCharacter, "bottom", ".", ".", "."),
+			glyphFromRows('b', "bottom", ".#", "##", ".#"),
+		},
+	}
+	pix, stride := drawRows(
+		"......##.#.",
+		"......#...#",
+		"......##.#.",
+		"##..#.....#",
+		"...##....#.",
+		"##..#.....#",
+	)
+	rect := image.Rect(0, 0, stride/4, 6)
+
+	unknown, err := NewUnknownGlyphs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(fonts, Options{Unknown: unknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if text, err := r.Decode(pix, stride, rect); err != nil || text != "ba" {
+			t.Fatalf("got %q, %v, want \"ba\"", text, err)
+		}
+	}
+
+	// nothing is saved until Flush
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) > 0 || unknown.Len() != 2 {
+		t.Fatalf("before Flush : %v unknown glyphs, files %v, want 2 and none", unknown.Len(), files)
+	}
+	if err = unknown.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	glyphs, err := ReadUnknownGlyphs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(glyphs) != 2 {
+		t.Fatalf("%v unknown glyphs saved, want 2", len(glyphs))
+	}
+	byFace := make(map[string]*UnknownGlyph)
+	for _, u := range glyphs {
+		byFace[u.Face] = u
+	}
+
+	// the run before 'b' is saved from the rows of its face, the run after 'a' from those of 'a'
+	tests := []struct {
+		face        string
+		lineYOffset int
+		context     string
+		pixels      Glyph
+	}{
+		{"bottom", 3, "[?]ba?", glyphFromRows('?', "", "##", "..", "##")},
+		{"top", 0, "?ba[?]", glyphFromRows('?', "", "#.", ".#", "#.")},
+	}
+	for _, test := range tests {
+		u := byFace[test.face]
+		if u == nil {
+			t.Errorf("no unknown glyph of face %q", test.face)
+			continue
+		}
+		if u.Width != 2 || u.Height != 3 || u.LineYOffset != test.lineYOffset || u.Count != 2 ||
+			len(u.Contexts) != 2 || u.Contexts[0] != test.context {
+			t.Errorf("face %q : got %+v", test.face, u)
+		}
+		got := readUnknownPixels(t, dir, u)
+		for i, p := range test.pixels.Pixels {
+			if got[i] != p {
+				t.Errorf("face %q : pixels %06x, want %06x", test.face, got, test.pixels.Pixels)
+				break
+			}
+		}
+		if _, err = os.Stat(filepath.Join(dir, u.LinePNGFile())); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// a glyph saved by an earlier run is counted, not saved again
+	unknown, err = NewUnknownGlyphs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err = New(fonts, Options{Unknown: unknown}); err != nil {
+		t.Fatal(err)
+	}
+	r.Decode(pix, stride, rect)
+	if err = unknown.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if glyphs, err = ReadUnknownGlyphs(dir); err != nil || len(glyphs) != 2 || glyphs[0].Count != 3 || len(glyphs[0].Contexts) != 3 {
+		t.Errorf("after another run : got %v glyphs, %v", len(glyphs), err)
+	}
+}
+
+func TestLabelUnknownGlyph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recognizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	captureDir, fontDir := filepath.Join(dir, "unknown"), filepath.Join(dir, "fonts")
+	if err = os.Mkdir(fontDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile(t, filepath.Join(testFontDir, "new_font_18.png"), fontDir)
+
+	// a font description without '7'
+	entries, err := readFontDescription(testFontDescription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var without []map[string]json.RawMessage
+	for _, entry := range entries {
+		if string(entry["Character"]) != `"7"` {
+			without = append(without, entry)
+		}
+	}
+	descriptionFile := filepath.Join(dir, "optimised_character_info.json")
+	if err = writeFontDescription(descriptionFile, without); err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(options Options, line string) string {
+		fonts, err := LoadFontSet(descriptionFile, fontDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := New(fonts, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.Decode(newLineRenderer(t).render(line), testLineWidth*4, testLineRect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	const line, decoded = "00:00:17,1,4,20,1", "00:00:17|1|4|20|1"
+	unknown, err := NewUnknownGlyphs(captureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decode(Options{Unknown: unknown}, line); got != "00:00:1|1|4|20|1" {
+		t.Fatalf("without a '7' got %q", got)
+	}
+	if err = unknown.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	glyphs, err := ReadUnknownGlyphs(captureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(glyphs) != 1 || glyphs[0].Contexts[0] != "00:00:1"+UnknownMarker+"|1|4|20|1" {
+		t.Fatalf("got %+v, want the '7' alone", glyphs)
+	}
+
+	u := glyphs[0]
+	if err = LabelUnknownGlyph(captureDir, u, '7', descriptionFile, fontDir); err != nil {
+		t.Fatal(err)
+	}
+	if got := decode(Options{}, line); got != decoded {
+		t.Errorf("with the '7' labelled, got %q, want %q", got, decoded)
+	}
+	if glyphs, err = ReadUnknownGlyphs(captureDir); err != nil || glyphs[0].Label != "7" {
+		t.Errorf("the label is not saved : %+v, %v", glyphs, err)
+	}
+	if _, err = os.Stat(filepath.Join(fontDir, "captured_"+u.PNGFile())); err != nil {
+		t.Error(err)
+	}
+}
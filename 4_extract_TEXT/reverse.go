@@ -0,0 +1,94 @@
+package main
+
+// The rows of a live scrape are streamed to a file in the order they are found, newest first,
+// and put into chronological order at the end. The 'reverse' command does the same for the
+// stream of a run that did not get to the end.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/output"
+)
+
+// streamFileName is where a live scrape streams its rows of format to.
+func streamFileName(format string) string {
+	return "extracted_text.stream" + output.Extension(format)
+}
+
+// extractedFileName is where the rows of format end up, in chronological order.
+func extractedFileName(format string) string {
+	return "extracted_text" + output.Extension(format)
+}
+
+func reverseUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s reverse [flags] [stream-file]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Puts the rows streamed by a live scrape (by default extracted_text.stream with the\n")
+		fmt.Fprintf(fs.Output(), "extension of the format) into chronological order, e.g. after a run that stopped early.\n\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runReverse is the 'reverse' command.
+func runReverse(args []string) error {
+	fs := flag.NewFlagSet("reverse", flag.ExitOnError)
+	outPath := fs.String("out", "", "file to write the rows to (default extracted_text with the extension of the format)")
+	formatFlag := fs.String("format", "", "output format of the stream, one of "+strings.Join(output.Formats, ", ")+" (default that of its status file, else 'OutputFormat' of the config file)")
+	configPath := fs.String("config", "./configuration/config.json", "path to config file")
+	fs.Usage = reverseUsage(fs)
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("only ONE stream file can be given")
+	}
+
+	format := *formatFlag
+	if format == "" && fs.NArg() == 0 {
+		config, _ := getConfig(*configPath)
+		format = config.OutputFormat
+	}
+	streamFile := fs.Arg(0)
+	if streamFile == "" {
+		streamFile = streamFileName(format)
+	}
+
+	status, err := output.ReadStreamStatus(streamFile)
+	if err != nil {
+		log.Printf("No status for %v (%v), the run is assumed NOT to have completed", streamFile, err)
+		status = &output.StreamStatus{}
+	}
+	if *formatFlag == "" && status.Format != "" {
+		format = status.Format
+	}
+	if format == "" {
+		config, _ := getConfig(*configPath)
+		format = config.OutputFormat
+	}
+	if *outPath == "" {
+		*outPath = extractedFileName(format)
+	}
+
+	if err = output.Reverse(streamFile, *outPath, format); err != nil {
+		return err
+	}
+	if status.Complete {
+		log.Printf("%v rows of a completed run written to %v", status.Rows, *outPath)
+	} else {
+		log.Printf("WARNING: the run that wrote %v did NOT complete (%v), so %v is missing its oldest rows",
+			streamFile, reasonOrUnknown(status.Reason), *outPath)
+		log.Printf("Rows written to %v", *outPath)
+	}
+	return nil
+}
+
+func reasonOrUnknown(reason string) string {
+	if reason == "" {
+		return "it stopped without saying why"
+	}
+	return reason
+}
@@ -0,0 +1,79 @@
+package scrape
+
+// Checkpoints of a scrape, so that one stopped part way (e.g. by a stray mouse movement)
+// can be carried on rather than started again from the top.
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// The phases of a scrape that a checkpoint can be in.
+const (
+	PhasePages = "pages" // scrolling a page at a time
+	PhaseLines = "lines" // scrolling a line at a time, after the pages have run out
+)
+
+// Checkpoint is where a scrape had got to when a page (or single line) was confirmed.
+// The extractor saves it as the Checkpoint of its stream's status.
+type Checkpoint struct {
+	Phase      string   // PhasePages or PhaseLines
+	Pages      int      // pages (and single lines) confirmed
+	Rows       int      // rows confirmed
+	LastLines  []string // text of the last rows confirmed, in the order they were scraped, for the final checks
+	LastHashes []string // pixel hash of each line on screen when the last row was confirmed
+}
+
+// ResumeFrom carries the scrape on from cp, rather than starting it from the top. The screens up to and
+// including the one cp was saved at are scrolled through without their rows being confirmed again.
+func (s *Scraper) ResumeFrom(cp *Checkpoint) {
+	s.resumeFrom = cp
+	if cp.Rows > len(cp.LastLines) {
+		s.rowsBefore = cp.Rows - len(cp.LastLines)
+	}
+	for _, text := range cp.LastLines {
+		s.Rows = append(s.Rows, recognizer.Row{Text: text, Fields: strings.Split(text, s.rec.Schema().Delimiter)})
+	}
+}
+
+// resuming is true while the screens scrolled through are ones whose rows are already confirmed,
+// that is up to and including the screen of the checkpoint being resumed from.
+func (s *Scraper) resuming(imageBytes []byte, phase string) bool {
+	if s.resumeFrom == nil {
+		return false
+	}
+	if s.resumeFrom.Phase == phase && sameStrings(s.lineHashes(imageBytes), s.resumeFrom.LastHashes) {
+		s.logf("Found the checkpoint on screen, carrying on after page %v", s.resumeFrom.Pages)
+		s.pages = s.resumeFrom.Pages - 1 // counted again by the caller
+		s.resumeFrom = nil
+	}
+	return true
+}
+
+// checkpoint returns where the scrape has got to, with the screen showing imageBytes.
+func (s *Scraper) checkpoint(phase string, imageBytes []byte) *Checkpoint {
+	cp := &Checkpoint{Phase: phase, Pages: s.pages + 1, Rows: s.rowsBefore + len(s.Rows), LastHashes: s.lineHashes(imageBytes)}
+	first := len(s.Rows) - 2*s.area.Lines // enough for the checks of the last pages
+	if first < 0 {
+		first = 0
+	}
+	for _, row := range s.Rows[first:] {
+		cp.LastLines = append(cp.LastLines, row.Text)
+	}
+	return cp
+}
+
+// lineHashes returns the FNV-1a hash of the pixels of each line of a grabbed image.
+func (s *Scraper) lineHashes(imageBytes []byte) []string {
+	lineBytes := s.lineBytes()
+	hashes := make([]string, 0, len(imageBytes)/lineBytes)
+	for offset := 0; offset+lineBytes <= len(imageBytes); offset += lineBytes {
+		h := fnv.New64a()
+		h.Write(imageBytes[offset : offset+lineBytes])
+		hashes = append(hashes, fmt.Sprintf("%016x", h.Sum64()))
+	}
+	return hashes
+}
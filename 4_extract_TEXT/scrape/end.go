@@ -0,0 +1,89 @@
+package scrape
+
+// The end of the document is only taken as reached on evidence of it: the grip of the scroll bar at the
+// bottom of its track, scrolling to the end (the End key, or a click at the bottom of the track) showing
+// the page already shown, or a line down that changes nothing once the page before it had stopped
+// changing, while the grip, if there is one, agrees.
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/events"
+)
+
+// The reasons a scrape takes the end of the document as reached, see EndReason.
+const (
+	EndGripAtBottom     = "grip_at_bottom"       // the grip of the scroll bar is at the bottom of its track
+	EndKeyMatchesPage   = "end_key_matches_page" // scrolling to the end, with Scroller.End, showed the page already shown
+	EndLineDownNoChange = "line_down_no_change"  // a line down did not change the page
+)
+
+// EndReason is why the scrape took the end of the document as reached, "" until it has.
+func (s *Scraper) EndReason() string {
+	return s.endReason
+}
+
+func (s *Scraper) ended(reason string) {
+	s.endReason = reason
+	s.logf("End of the document : %v", reason)
+	s.emit(events.Event{Event: events.EndOfDocument, Reason: reason})
+}
+
+// atEnd is true once pageImage, the page (or single line) just appended in phase, is shown to be the
+// last: by the grip being at the bottom of its track, or, with the grip a row or two short of it, by the
+// Scroller.End scrolling to the same page. If it scrolls further, the page it scrolls to is appended
+// and returned in place of pageImage.
+func (s *Scraper) atEnd(pageImage []byte, phase string) (bool, []byte, error) {
+	for tries := 0; tries < 2 && s.resumeFrom == nil && s.gripOK; tries++ {
+		if s.grip.AtBottom() {
+			s.ended(EndGripAtBottom)
+			return true, pageImage, nil
+		}
+		if !s.nearBottom() {
+			break
+		}
+
+		s.scroll.End()
+		endImage, err := s.settledPage()
+		if err != nil {
+			return false, nil, err
+		}
+		if bytes.Equal(endImage, pageImage) {
+			s.ended(EndKeyMatchesPage)
+			return true, pageImage, nil
+		}
+
+		// End scrolled on, so keep the lines it scrolled into view
+		lastHashes := s.lineHashes(pageImage)
+		s.captured()
+		if pageImage, err = s.appendPage(endImage, lastHashes, phase); err != nil {
+			return false, nil, err
+		}
+		s.pages++
+	}
+	return false, pageImage, nil
+}
+
+// settledPage grabs the page after a scroll, once two grabs of it in a row are the same.
+func (s *Scraper) settledPage() ([]byte, error) {
+	s.Sleep(250 * time.Millisecond) // give the key press or click time to get update done
+	page, err := s.grab(s.area.page(), 5)
+	if err != nil {
+		return nil, err
+	}
+	for tries := 0; tries < 20; tries++ {
+		s.Sleep(50 * time.Millisecond)
+		again, err := s.grab(s.area.page(), 5)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(page, again) {
+			return page, nil
+		}
+		s.emit(events.Event{Event: events.Retry, Reason: "page changed between grabs"})
+		page = again
+	}
+	return nil, &Error{Kind: CaptureFailure, Err: errors.New("the page did not stop changing after it was scrolled")}
+}
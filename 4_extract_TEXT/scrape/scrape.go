@@ -0,0 +1,744 @@
+// Package scrape is the state machine of the extractor: page down and grab until the page does not
+// change, then single line down and grab until a line down changes nothing, then check the last pages
+// against what was scraped. With a scroll bar to measure, the end is usually found while paging.
+//
+// What is grabbed and how it is scrolled are behind the ScreenSource and Scroller interfaces, so that
+// the same scrape runs against X11 in the extractor and against an in-memory window in tests.
+package scrape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/events"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// ScreenSource grabs pixels of the window being scraped.
+type ScreenSource interface {
+	// Grab returns the pixels of r as 4 bytes each (BGRX, as X11 ZPixmap), a row at a time.
+	Grab(r image.Rectangle) ([]byte, error)
+}
+
+// Scroller scrolls the window being scraped.
+type Scroller interface {
+	Home()     // as far up as it goes, before the first page is grabbed
+	End()      // as far down as it goes
+	LineUp()   // a line up
+	LineDown() // a line down, once the page downs have run out
+	PageUp()   // a page up, to check the last but one page
+	PageDown() // a page down
+}
+
+// Area is where the lines of text are in a ScreenSource.
+type Area struct {
+	X, Y  int // top left of the first line
+	Width int
+	Pitch int // rows of pixels from the top of one line to the top of the next, which is the height grabbed of a line
+	Lines int // shown at once
+}
+
+func (a Area) page() image.Rectangle {
+	return image.Rect(a.X, a.Y, a.X+a.Width, a.Y+a.Pitch*a.Lines)
+}
+
+func (a Area) line(n int) image.Rectangle {
+	return image.Rect(a.X, a.Y+a.Pitch*n, a.X+a.Width, a.Y+a.Pitch*(n+1))
+}
+
+// Errors that stop a scrape other than a failed grab or conversion.
+var (
+	ErrUserExit           = errors.New("user exit")
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+)
+
+// Kind is the class of what stopped a scrape, which the extractor maps to its exit code.
+type Kind int
+
+// The kinds of Error.
+const (
+	CaptureFailure       Kind = iota + 1 // a grab failed, grabbed what can not be on screen (a black line), or line downs were lost
+	FontMismatch                         // the pixels of a line are not those of the font
+	SchemaViolation                      // a line was read, but is not a row of the schema
+	UserAbort                            // Stopped was true
+	VerificationMismatch                 // the last pages are not the last rows scraped
+	OutputFailure                        // Confirmed returned an error
+	CheckpointNotFound                   // the screen of the checkpoint being resumed from was not scrolled to
+	ScrollGap                            // a page could not be lined up with the one before, even scrolled back
+)
+
+var kindNames = map[Kind]string{
+	CaptureFailure:       "capture failure",
+	FontMismatch:         "font mismatch",
+	SchemaViolation:      "schema violation",
+	UserAbort:            "user abort",
+	VerificationMismatch: "verification mismatch",
+	OutputFailure:        "output failure",
+	CheckpointNotFound:   "checkpoint not found",
+	ScrollGap:            "scroll gap",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind %d", int(k))
+}
+
+// Error stops a scrape.
+type Error struct {
+	Kind  Kind
+	Err   error  // what went wrong
+	Image []byte // the line that could not be converted, as grabbed, nil for none
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// conversionError returns the Error of a line that could not be converted: a font mismatch unless the
+// line was read but is not laid out as the schema says.
+func conversionError(err error, image []byte) *Error {
+	kind := FontMismatch
+	switch recognizer.ErrorCode(err) {
+	case recognizer.ConversionErrorWrongNumberOfSections, recognizer.ConversionErrorTimeFormatWrong, recognizer.ConversionErrorFieldInvalid:
+		kind = SchemaViolation
+	}
+	return &Error{Kind: kind, Err: err, Image: image}
+}
+
+// Scraper scrapes every line of the window in its Area.
+type Scraper struct {
+	// Rows are those scraped so far, in the order they were scraped (bottom of the window last).
+	Rows []recognizer.Row
+
+	// Workers is how many lines of a page are converted at once.
+	Workers int
+
+	// Confirmed, if set, is called with the rows of each page (or single line) as it is confirmed, and
+	// the checkpoint of the scrape after them. The scrape stops if it returns an error.
+	Confirmed func(rows []recognizer.Row, cp *Checkpoint) error
+
+	// Stopped, if set, is polled after each grab and the scrape stops with ErrUserExit once it is true.
+	Stopped func() bool
+
+	// Sleep waits for the window to be updated, time.Sleep unless the window is not a real one.
+	Sleep func(time.Duration)
+
+	// Event, if set, is called with each step of the scrape's progress, with its Phase set.
+	Event func(e events.Event)
+
+	// Track, if set, is the scroll bar of the window, for estimates of the length of the document.
+	Track *Track
+
+	// Now is the time, time.Now unless the window is not a real one.
+	Now func() time.Time
+
+	source ScreenSource
+	scroll Scroller
+	rec    *recognizer.Recognizer
+	area   Area
+	stitch *stitcher
+
+	resumeFrom *Checkpoint // until the screen it was saved at is found again
+	rowsBefore int         // scraped before those of Rows, by the run being resumed from
+	phase      string      // one of the events.Phase... constants
+	pages      int         // pages (and single lines) scrolled
+	grabs      int
+	delay      time.Duration // slept while paging
+
+	started     time.Time
+	grip        Grip // as last measured
+	gripOK      bool
+	loggedTenth int // of the document, that the estimate of how much is done was last logged at
+
+	endReason string // one of the End... constants, once the end of the document is reached
+}
+
+// New returns a Scraper of the lines in area of source, scrolled by scroll and converted by rec.
+func New(source ScreenSource, scroll Scroller, rec *recognizer.Recognizer, area Area) *Scraper {
+	return &Scraper{
+		Workers: 1,
+		Sleep:   time.Sleep,
+		Now:     time.Now,
+		source:  source,
+		scroll:  scroll,
+		rec:     rec,
+		area:    area,
+		stitch:  newStitcher(rec.Schema()),
+	}
+}
+
+func (s *Scraper) logf(format string, a ...interface{}) {
+	log.Printf(format, a...)
+}
+
+func (s *Scraper) emit(e events.Event) {
+	if s.Event != nil {
+		e.Phase = s.phase
+		s.Event(e)
+	}
+}
+
+func (s *Scraper) setPhase(phase string) {
+	s.phase = phase
+	s.emit(events.Event{Event: events.PhaseChange})
+}
+
+func (s *Scraper) lineBytes() int {
+	return s.area.Width * s.area.Pitch * 4
+}
+
+func (s *Scraper) grab(r image.Rectangle, n int) ([]byte, error) {
+	imageBytes, err := s.source.Grab(r)
+	if err != nil {
+		s.logf("Grab FAIL %v", n)
+		return nil, &Error{Kind: CaptureFailure, Err: fmt.Errorf("grab %v : %v", n, err)}
+	}
+	s.grabs++
+	return imageBytes, nil
+}
+
+func (s *Scraper) stopped() error {
+	if s.Stopped != nil && s.Stopped() {
+		return &Error{Kind: UserAbort, Err: ErrUserExit}
+	}
+	return nil
+}
+
+func (s *Scraper) confirm(rows []recognizer.Row, phase string, imageBytes []byte) error {
+	if s.Confirmed != nil {
+		if err := s.Confirmed(rows, s.checkpoint(phase, imageBytes)); err != nil {
+			return &Error{Kind: OutputFailure, Err: err}
+		}
+	}
+	done := s.rowsBefore + len(s.Rows)
+	e := events.Event{Event: events.LinesAppended, Lines: len(rows), Rows: done}
+	if est, ok := s.estimate(done); ok {
+		e.TotalLines = est.lines
+		e.Percent = math.Round(est.percent*10) / 10
+		e.ETAMS = est.eta.Milliseconds()
+		if tenth := int(est.percent / 10); tenth > s.loggedTenth {
+			s.logf("About %v lines, %.0f%% done, %v to go", est.lines, est.percent, est.eta.Round(time.Second))
+			s.loggedTenth = tenth
+		}
+	}
+	s.emit(e)
+	return nil
+}
+
+// captured measures the grip of the scroll bar with a page that has been captured and stopped changing.
+func (s *Scraper) captured() {
+	s.grip, s.gripOK = s.measureGrip()
+	e := events.Event{Event: events.PageCaptured, Page: s.pages + 1}
+	if s.gripOK {
+		e.GripTop, e.GripSize = s.grip.Top, s.grip.Size
+	}
+	s.emit(e)
+}
+
+type conversionResult struct {
+	index int
+	row   recognizer.Row
+	err   error
+}
+
+// checkLine expands any conversion error for easier reading and returns its code.
+func (s *Scraper) checkLine(result conversionResult) int {
+	if result.err != nil {
+		s.logf("%v", result.err)
+		var ce *recognizer.ConversionError
+		if errors.As(result.err, &ce) && ce.Text != "" {
+			s.logf("Line is : %v", ce.Text)
+		}
+		return recognizer.ErrorCode(result.err)
+	}
+
+	return recognizer.ConversionGood
+}
+
+// convertLine converts line 'lineNumber' of an image grabbed as a stack of lines.
+func (s *Scraper) convertLine(imageBytes []byte, lineNumber int) conversionResult {
+	row, err := s.rec.Row(imageBytes, s.area.Width*4, image.Rect(0, lineNumber*s.area.Pitch, s.area.Width, (lineNumber+1)*s.area.Pitch))
+	return conversionResult{index: lineNumber, row: row, err: err}
+}
+
+// convertPage converts the lines of a grabbed page, Workers at a time.
+func (s *Scraper) convertPage(imageBytes []byte) []conversionResult {
+	textResult := make([]conversionResult, s.area.Lines)
+	semaphoreChan := make(chan struct{}, s.Workers)
+	var wg sync.WaitGroup // number of working goroutines
+
+	for lineNum := 0; lineNum < s.area.Lines; lineNum++ {
+		semaphoreChan <- struct{}{} // block while full
+
+		wg.Add(1)
+		// Worker
+		go func(lineToConvert int) {
+			defer func() {
+				<-semaphoreChan // read to release a slot
+			}()
+
+			defer wg.Done()
+
+			textResult[lineToConvert] = s.convertLine(imageBytes, lineToConvert)
+		}(lineNum)
+	}
+	wg.Wait()
+
+	return textResult
+}
+
+// pageSleep waits for d, counting it towards the delay of paging.
+func (s *Scraper) pageSleep(d time.Duration) {
+	s.Sleep(d)
+	s.delay += d
+}
+
+// Run scrapes the window from the top (or the checkpoint being resumed from) to the bottom.
+func (s *Scraper) Run() error {
+	// ensure the window is at the top
+	s.started = s.Now()
+	s.scroll.Home()
+	s.Sleep(250 * time.Millisecond)
+	s.setPhase(events.PhasePaging)
+
+	lastImage, err := s.runPages()
+	if err != nil {
+		return err
+	}
+	if s.resumeFrom != nil && s.resumeFrom.Phase == PhasePages {
+		s.logf("The checkpoint page was not found, so the run can not be resumed : start it again without '-resume'")
+		return &Error{Kind: CheckpointNotFound, Err: ErrCheckpointNotFound}
+	}
+
+	s.logf("# of pages: %v, total delay time in ms : %v, average delay per page %.2fms", s.pages, s.delay.Milliseconds(), float64(s.delay.Milliseconds())/float64(s.pages))
+	s.logf("nofGrabs: %v", s.grabs)
+	if s.endReason != "" {
+		return nil
+	}
+
+	s.setPhase(events.PhaseSingleLine)
+
+	if err := s.runLines(lastImage); err != nil {
+		return err
+	}
+	if s.resumeFrom != nil {
+		s.logf("The checkpoint line was not found, so the run can not be resumed : start it again without '-resume'")
+		return &Error{Kind: CheckpointNotFound, Err: ErrCheckpointNotFound}
+	}
+	return nil
+}
+
+// runPages pages down and grabs until the last page is shown to be the end of the document, or
+// until the page does not change, and returns the last page.
+func (s *Scraper) runPages() ([]byte, error) {
+	// get and save the first image
+	lastImage, err := s.grab(s.area.page(), 1)
+	if err != nil {
+		return nil, err
+	}
+	s.captured()
+
+	if !s.resuming(lastImage, PhasePages) {
+		// extract the data for the FIRST screen ...
+		textResult := s.convertPage(lastImage)
+		var rows []recognizer.Row
+		for lineNum, convertedResult := range textResult {
+			if s.checkLine(convertedResult) != recognizer.ConversionGood {
+				s.logf("Stopping, as we should not have an error in the first screen grab")
+				s.logf("Maybe the font has changed ?")
+				return nil, conversionError(convertedResult.err, lastImage[lineNum*s.lineBytes():(lineNum+1)*s.lineBytes()])
+			}
+			rows = append(rows, convertedResult.row)
+		}
+		s.Rows = append(s.Rows, rows...)
+		if err := s.confirm(rows, PhasePages, lastImage); err != nil {
+			return nil, err
+		}
+	}
+
+	s.pages++
+	end, lastImage, err := s.atEnd(lastImage, PhasePages)
+	if err != nil || end {
+		return lastImage, err
+	}
+
+	sameCount := 0
+	totalPartialCount := 0
+
+	// scroll window down one page
+	s.scroll.PageDown()
+	s.pageSleep(100 * time.Millisecond) // give mouse click action time to get update done
+
+	// NOTE: The timing delays in the following seem to give the correct results.
+	//       Any quicker and the results are wrong !
+	//       That is 0.1 seconds after mouse click and 40ms delay for check.
+	//
+	//	So, leave them as they are or if needs be, make them slower.
+	//
+
+	for {
+		newImage, err := s.grab(s.area.page(), 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(lastImage, newImage) { // The image is the same (took ~ 1.0x ms to do comparison for same image)
+			sameCount++
+			if sameCount > 10 {
+				s.logf("Same image : %v", sameCount)
+			}
+			if sameCount == 11 {
+				s.emit(events.Event{Event: events.Stall, Reason: "page unchanged after page down"})
+			}
+			if sameCount > 25 {
+				// The image has not changed for ~250ms, therefore we must be at the end of
+				// 'page down' causing a scroll to happen, so mov on to next stage ...
+				// (which is not the end of the document until a line down changes nothing)
+				// It's 250ms because sometimes other background task's kick in and cause
+				// significant delays
+				s.logf("Do NOT touch the Mouse, until this Application has finished ...")
+				return lastImage, nil
+			}
+		} else {
+			// (typically takes ~ < 2us for comparison to determine images are different, but sometimes ~300us
+			//  ... possibly due to garbage collection)
+			//
+			// we potentially have a completely new image, but may have grabed it part way through
+			// the other process updating its window ...
+			// so we wait another 0.04 seconds, take another grab and compare again
+			s.pageSleep(40 * time.Millisecond)
+
+			new2Image, err := s.grab(s.area.page(), 3)
+			if err != nil {
+				return nil, err
+			}
+
+			if bytes.Equal(new2Image, newImage) { // the second grab of image is now same
+				lastHashes := s.lineHashes(lastImage)
+				lastImage = newImage
+				s.captured()
+
+				if !s.resuming(lastImage, PhasePages) {
+					if lastImage, err = s.appendPage(lastImage, lastHashes, PhasePages); err != nil {
+						return nil, err
+					}
+				}
+
+				sameCount = 0
+				s.pages++
+				end, lastImage, err = s.atEnd(lastImage, PhasePages)
+				if err != nil || end {
+					return lastImage, err
+				}
+
+				// scroll window down one page
+				s.scroll.PageDown()
+
+				s.pageSleep(10 * time.Millisecond) // give mouse click action time to get update done
+				// dynamically add additional delays depending on how many times we have added additional delays
+				if totalPartialCount > 40 {
+					s.pageSleep(40 * time.Millisecond)
+					totalPartialCount-- // back off delays to try and achieve optimum
+				} else if totalPartialCount > 30 {
+					s.pageSleep(30 * time.Millisecond)
+					totalPartialCount--
+				} else if totalPartialCount > 20 {
+					s.pageSleep(20 * time.Millisecond)
+					totalPartialCount--
+				} else if totalPartialCount > 10 {
+					s.pageSleep(10 * time.Millisecond)
+				}
+			} else {
+				totalPartialCount++
+				s.emit(events.Event{Event: events.Retry, Reason: "page changed between grabs"})
+				// not a full update, so loop around and try again ...
+			}
+		}
+
+		s.pageSleep(10 * time.Millisecond) // give mouse click action time to get update done
+
+		if err := s.stopped(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// appendPage converts a page that has been scrolled to, and keeps the lines that have scrolled into view
+// since the page before, whose lines had lastHashes, confirming them in phase. If the page does not
+// overlap the one before enough to be sure no lines were scrolled past, the window is scrolled back a
+// line at a time, up to a page, until it does. It returns the page the lines were kept from.
+func (s *Scraper) appendPage(pageImage []byte, lastHashes []string, phase string) ([]byte, error) {
+	// line the page up with the one before, which is the last 'Lines' lines found,
+	// and keep only the lines that have scrolled into view
+	lastPage := s.Rows[len(s.Rows)-s.area.Lines:]
+	for lineUps := 0; ; lineUps++ {
+		pageRows, err := s.pageRows(pageImage)
+		if err != nil {
+			return nil, err
+		}
+		newLines, ok, warning := s.stitch.newLines(lastPage, lastHashes, pageRows, s.lineHashes(pageImage))
+		if ok {
+			if lineUps > 0 {
+				s.grip, s.gripOK = s.measureGrip()
+			}
+			if warning != "" {
+				s.logf("WARNING: page %v : %v", s.pages, warning)
+				s.emit(events.Event{Event: events.Warning, Page: s.pages + 1, Reason: warning})
+			}
+			if newLines != s.area.Lines {
+				s.logf("Page %v scrolled %v lines", s.pages, newLines)
+			}
+			s.Rows = append(s.Rows, pageRows[s.area.Lines-newLines:]...)
+			return pageImage, s.confirm(s.Rows[len(s.Rows)-newLines:], phase, pageImage)
+		}
+
+		if lineUps == s.area.Lines {
+			return nil, &Error{Kind: ScrollGap, Err: fmt.Errorf("page %v could not be lined up with the page before, even after %v line ups", s.pages+1, lineUps)}
+		}
+		if lineUps == 0 {
+			s.logf("Page %v does not overlap the page before, so scrolling back until it does", s.pages)
+		}
+		s.emit(events.Event{Event: events.Retry, Reason: "page does not overlap the page before"})
+		s.scroll.LineUp()
+		if pageImage, err = s.settledPage(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// pageRows converts each line of a page into a row.
+func (s *Scraper) pageRows(pageImage []byte) ([]recognizer.Row, error) {
+	textResult := s.convertPage(pageImage)
+	pageRows := make([]recognizer.Row, s.area.Lines)
+	for lineNum, convertedResult := range textResult {
+		if s.checkLine(convertedResult) != recognizer.ConversionGood {
+			s.logf("Stopping 2, as we should not have an error in page: %v", s.pages)
+			s.logf("Maybe the font has changed ?")
+			return nil, conversionError(convertedResult.err, pageImage[lineNum*s.lineBytes():(lineNum+1)*s.lineBytes()])
+		}
+		pageRows[lineNum] = convertedResult.row
+	}
+	return pageRows, nil
+}
+
+// runLines single line downs and grabs, after the page downs have run out at lastImage, until a
+// line down changes nothing, or the grip of the scroll bar shows the end. A line down that changes
+// nothing while the grip is not at the bottom is taken as lost and clicked again, up to
+// maxLostLineDowns times in a row, rather than as the end. Otherwise it is only taken as the end
+// once scrolling to the end, with Scroller.End, shows the same page.
+func (s *Scraper) runLines(lastImage []byte) error {
+	const maxLostLineDowns = 5
+	lineDown := true
+	unchanged := 0     // grabs the same as lastImage since the line down
+	lostLineDowns := 0 // in a row, that changed nothing while the grip was not at the bottom
+	for {
+		// scroll up 1 line
+		if lineDown {
+			s.scroll.LineDown()
+			lineDown = false
+		}
+		s.Sleep(250 * time.Millisecond) // give mouse click action time to get update done
+
+		newImage, err := s.grab(s.area.page(), 4)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(lastImage, newImage) { // The image is the same (the other application has not yet updated the page from the mouse click)
+			unchanged++
+			if unchanged == 1 {
+				s.emit(events.Event{Event: events.Stall, Reason: "page unchanged after line down"})
+			} else if s.gripOK && !s.grip.AtBottom() {
+				// the grip says there is more to come, so the click was most likely lost : try again
+				if lostLineDowns == maxLostLineDowns {
+					return &Error{Kind: CaptureFailure, Err: fmt.Errorf("%v line downs in a row made no change, but the grip of the scroll bar is not at the bottom of its track", lostLineDowns+1)}
+				}
+				lostLineDowns++
+				s.logf("The line down made no change, but the grip of the scroll bar is not at the bottom of its track, so trying again")
+				s.emit(events.Event{Event: events.Retry, Reason: "line down made no change before the grip reached the bottom"})
+				unchanged = 0
+				lineDown = true
+			} else {
+				// lastImage had stopped changing before the line down, and is still the same
+				// 500ms after it, so the line down has made no change : which is the last line
+				// being shown, if scrolling to the end shows the same page
+				s.scroll.End()
+				endImage, err := s.settledPage()
+				if err != nil {
+					return err
+				}
+				if bytes.Equal(endImage, lastImage) {
+					s.ended(EndLineDownNoChange)
+					return nil
+				}
+
+				// it was a lost line down, so keep the lines scrolling to the end brought into view and go on
+				s.logf("The line down made no change, but scrolling to the end did, so going on")
+				lastHashes := s.lineHashes(lastImage)
+				s.captured()
+				if lastImage, err = s.appendPage(endImage, lastHashes, PhaseLines); err != nil {
+					return err
+				}
+				s.pages++
+				end, page, err := s.atEnd(lastImage, PhaseLines)
+				if err != nil || end {
+					return err
+				}
+				lastImage = page
+				unchanged = 0
+				lineDown = true
+			}
+		} else {
+			s.Sleep(500 * time.Millisecond) // just to be sure
+			// grab just the last line
+			oneLineImage, err := s.grab(s.area.line(s.area.Lines-1), 6)
+			if err != nil {
+				return err
+			}
+			var linesSame = 0
+			for m := 0; m < 5; m++ {
+				s.Sleep(50 * time.Millisecond)
+				oneLineImage2, err := s.grab(s.area.line(s.area.Lines-1), 6)
+				if err != nil {
+					return err
+				}
+				if bytes.Equal(oneLineImage, oneLineImage2) {
+					linesSame++
+				}
+			}
+			if linesSame == 5 {
+				// The image grab for the whole page is stable ...
+
+				unchanged = 0
+				lostLineDowns = 0
+				lineDown = true
+				lastImage = newImage
+				s.captured()
+
+				if !s.resuming(newImage, PhaseLines) {
+					if err := s.appendLine(oneLineImage, newImage); err != nil {
+						return err
+					}
+				}
+
+				s.pages++
+				end, page, err := s.atEnd(lastImage, PhaseLines)
+				if err != nil || end {
+					return err
+				}
+				lastImage = page
+
+			} else {
+				// The image grab for the whole page changed ...
+				// but the last line has not stabilised, so go try again.
+				s.emit(events.Event{Event: events.Retry, Reason: "last line still changing"})
+			}
+		}
+
+		if err := s.stopped(); err != nil {
+			return err
+		}
+	}
+}
+
+// appendLine converts the line that has scrolled into view at the bottom of the page.
+func (s *Scraper) appendLine(oneLineImage []byte, pageImage []byte) error {
+	convertedResult := s.convertLine(oneLineImage, 0)
+	if s.checkLine(convertedResult) != recognizer.ConversionGood {
+		s.logf("There is definately a problem with this line")
+		s.logf("Stopping 4, as we should not have an error in page: %v", s.pages)
+		s.logf("Maybe the font has changed ?")
+		return conversionError(convertedResult.err, oneLineImage)
+	}
+	s.Rows = append(s.Rows, convertedResult.row)
+	if err := s.confirm(s.Rows[len(s.Rows)-1:], PhaseLines, pageImage); err != nil {
+		return err
+	}
+
+	// NOTE: on one occasion a black line was grab'd
+	//       BUT was not repeatable and i could not
+	//       see how this could happen.
+	//       ... But a black imaged saved off will later break the
+	//           processing pipe line, so we STOP here and then
+	//           investigate  OR  re-try ...
+
+	pixOffset := ((3 * s.area.Width) + 100) * 4 // (3 lines down, 100 pixels across) multiplied by bytes per pixel
+	if pixOffset+4 <= len(oneLineImage) && binary.LittleEndian.Uint32(oneLineImage[pixOffset:])&0xFFFFFF == 0 {
+		s.logf("Pixel at 100, 3 'and' maybe line is BLACK ... it must NOT be this way\n")
+		s.logf("Re-run and if it happens again, place breakpoint here")
+		s.logf("  and runing Debugger to examine variables, etc")
+		return &Error{Kind: CaptureFailure, Err: errors.New("black line grabbed"), Image: oneLineImage}
+	}
+	return nil
+}
+
+// LastPages grabs the lines of the last page, and of the last but one if checkLastButOne, bottom
+// line first. They are used as a sanity check that the last lines grabbed via single line scroll
+// have been done correctly, see Verify.
+func (s *Scraper) LastPages(checkLastButOne bool) ([]recognizer.Row, error) {
+	var lastLines []recognizer.Row
+	s.setPhase(events.PhaseVerification)
+
+	if len(s.Rows) < 2*s.area.Lines {
+		checkLastButOne = false // there is not a whole page before the last one
+	}
+
+	var nofLastPagesToCheck int = 1
+	if checkLastButOne {
+		nofLastPagesToCheck = 2
+	}
+
+	for nofLastPagesToCheck > 0 {
+		// Grab last pages lines in reverse order to save having to reverse the list
+		for lineNum := s.area.Lines - 1; lineNum >= 0; lineNum-- { // starting at last line
+			oneLineImage, err := s.grab(s.area.line(lineNum), 7)
+			if err != nil {
+				return nil, err
+			}
+
+			convertedResult := s.convertLine(oneLineImage, 0)
+			if s.checkLine(convertedResult) != recognizer.ConversionGood {
+				// hmmm, not a good capture ...save for inspection to analyse problem
+				s.logf("Stopping 5, as we should not have an error in page: %v", s.pages)
+				s.logf("Maybe the font has changed ?")
+				return nil, conversionError(convertedResult.err, oneLineImage)
+			}
+			lastLines = append(lastLines, convertedResult.row)
+		}
+
+		if checkLastButOne && nofLastPagesToCheck > 1 {
+			// scroll up a page
+			s.scroll.PageUp()
+			s.Sleep(500 * time.Millisecond) // should be plenty of time for the update to complete
+		}
+		nofLastPagesToCheck--
+	}
+	return lastLines, nil
+}
+
+// Verify checks that lastLines, from LastPages, are the last of the rows scraped.
+func (s *Scraper) Verify(lastLines []recognizer.Row) error {
+	for i := range lastLines {
+		if i >= len(s.Rows) || lastLines[i].Text != s.Rows[len(s.Rows)-1-i].Text {
+			var scraped string
+			if i < len(s.Rows) {
+				scraped = s.Rows[len(s.Rows)-1-i].Text
+			}
+			s.logf("Line mismatch at line : %v   %s  !=  %s", i+1, lastLines[i].Text, scraped)
+			s.logf("You might try increasing the value of 'PageDownOffset' by 1 in config.json and running again.")
+			s.logf("NOTE: This problem is not captured when flag 'CheckLastButOnePage' in config.json is set to '0'")
+			s.logf(" - to demonstrate, run the stage 6 script '6_test_to_failure.sh' with above flag set to '0'")
+			return &Error{Kind: VerificationMismatch, Err: fmt.Errorf("line %v from the end is %q, but %q was scraped", i+1, lastLines[i].Text, scraped)}
+		}
+	}
+	return nil
+}
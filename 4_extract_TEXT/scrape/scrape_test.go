@@ -0,0 +1,508 @@
+package scrape_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/events"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/scrape"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/simulator"
+)
+
+const (
+	testFontDescription = "../optimised_character_info.json"
+	testFontDir         = "../../2_create_font_PNGs/font_source_bitmaps"
+	testMockFonts       = "../../2_create_font_PNGs/font_character_info.json"
+	testMockFontDir     = "../../2_create_font_PNGs/font_bitmaps/"
+	testMockLine        = "../../3_scroll_window_Mock/sprites/lineWhite18.png"
+	testMockData        = "../../1_mock_data/mock_data.csv"
+
+	testLinesShown = 50
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard) // the scrape logs as it goes, as the extractor does
+	os.Exit(m.Run())
+}
+
+var testFont *simulator.Font
+
+// newTestWindow returns a simulated mock window of the first n lines of the mock data.
+func newTestWindow(t *testing.T, n int) (*simulator.Window, []string) {
+	if testFont == nil {
+		var err error
+		if testFont, err = simulator.LoadFont(testMockFonts, testMockFontDir, testMockLine); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines, err := simulator.ReadLines(testMockData, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return simulator.New(testFont, lines, testLinesShown), lines
+}
+
+// newTestScraper returns a Scraper of window, with the font set and schema of the extractor.
+func newTestScraper(t *testing.T, window *simulator.Window) *scrape.Scraper {
+	return newSchemaScraper(t, window, nil)
+}
+
+// newSchemaScraper returns a Scraper of window that checks its rows with schema, nil for the default.
+func newSchemaScraper(t *testing.T, window *simulator.Window, schema *recognizer.Schema) *scrape.Scraper {
+	fonts, err := recognizer.LoadFontSet(testFontDescription, testFontDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := recognizer.New(fonts, recognizer.Options{PriorKnowledgeSpeedup: true, Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scrape.New(window, window, rec, scrape.Area{Width: simulator.LineWidth, Pitch: simulator.LinePitch, Lines: testLinesShown})
+	s.Workers = 4
+	s.Sleep = window.Sleep
+	s.Now = window.Now
+	return s
+}
+
+// scrapeAll runs s to the end and checks its last pages, as the extractor does.
+func scrapeAll(s *scrape.Scraper) error {
+	if err := s.Run(); err != nil {
+		return err
+	}
+	lastLines, err := s.LastPages(true)
+	if err != nil {
+		return err
+	}
+	return s.Verify(lastLines)
+}
+
+func rowTexts(rows []recognizer.Row) []string {
+	texts := make([]string, len(rows))
+	for i, row := range rows {
+		texts[i] = row.Text
+	}
+	return texts
+}
+
+func checkLines(t *testing.T, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("scraped %v lines, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("line %v is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScrape(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		lines  int
+		faults simulator.Faults
+	}{
+		{name: "one page", lines: 50},
+		{name: "last page part full", lines: 120},
+		{name: "many pages", lines: 1001},
+		{name: "slow window", lines: 320, faults: simulator.Faults{Latency: 150 * time.Millisecond}},
+		{name: "torn grabs", lines: 320, faults: simulator.Faults{Latency: 100 * time.Millisecond, Tearing: 30 * time.Millisecond}},
+		{name: "short page down", lines: 320, faults: simulator.Faults{ShortPageDowns: map[int]int{2: 37, 4: 1}}},
+		{name: "page down of more than a page", lines: 320, faults: simulator.Faults{ShortPageDowns: map[int]int{3: 51}}},
+		{name: "lost page down", lines: 180, faults: simulator.Faults{LostScrolls: map[int]bool{3: true}}},
+		// a line down that is not acted on looks the same as the end, until scrolling to the end shows it is not
+		{name: "lost line down", lines: 180, faults: simulator.Faults{LostScrolls: map[int]bool{4: true, 6: true}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			window, lines := newTestWindow(t, test.lines)
+			window.Faults = test.faults
+			s := newTestScraper(t, window)
+
+			var confirmed []recognizer.Row
+			s.Confirmed = func(rows []recognizer.Row, cp *scrape.Checkpoint) error {
+				confirmed = append(confirmed, rows...)
+				return nil
+			}
+			if err := scrapeAll(s); err != nil {
+				t.Fatal(err)
+			}
+			checkLines(t, rowTexts(s.Rows), lines)
+			checkLines(t, rowTexts(confirmed), lines)
+		})
+	}
+}
+
+func TestScrapeErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		faults   simulator.Faults
+		stopped  bool
+		wantKind scrape.Kind
+		wantErr  error
+		image    bool
+	}{
+		{name: "first grab fails", faults: simulator.Faults{FailGrab: 1}, wantKind: scrape.CaptureFailure},
+		{name: "paging grab fails", faults: simulator.Faults{FailGrab: 4}, wantKind: scrape.CaptureFailure},
+		{name: "black line on first page", faults: simulator.Faults{BlackLines: map[int]bool{10: true}}, wantKind: scrape.FontMismatch, image: true},
+		{name: "black line on a later page", faults: simulator.Faults{BlackLines: map[int]bool{110: true}}, wantKind: scrape.FontMismatch, image: true},
+		{name: "black last line", faults: simulator.Faults{BlackLines: map[int]bool{179: true}}, wantKind: scrape.FontMismatch, image: true},
+		{name: "user exit", stopped: true, wantKind: scrape.UserAbort, wantErr: scrape.ErrUserExit},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			window, _ := newTestWindow(t, 180)
+			window.Faults = test.faults
+			window.Faults.LostScrolls = map[int]bool{4: true} // the third page down, so that the rest are scrolled to a line at a time
+			s := newTestScraper(t, window)
+			s.Stopped = func() bool { return test.stopped }
+
+			err := scrapeAll(s)
+			var se *scrape.Error
+			if !errors.As(err, &se) {
+				t.Fatalf("got %v, want a *scrape.Error", err)
+			}
+			if se.Kind != test.wantKind {
+				t.Fatalf("got a %v (%v), want a %v", se.Kind, err, test.wantKind)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("got %v, want %v", err, test.wantErr)
+			}
+			if test.image && len(se.Image) != simulator.LineWidth*simulator.LinePitch*4 {
+				t.Fatalf("got an image of %v bytes, want the line", len(se.Image))
+			}
+		})
+	}
+}
+
+func TestSchemaViolation(t *testing.T) {
+	window, lines := newTestWindow(t, 120)
+	lines[70] = strings.Replace(lines[70], ":", "", 1) // drawn in the font, but not a time
+	s := newTestScraper(t, window)
+
+	err := scrapeAll(s)
+	var se *scrape.Error
+	if !errors.As(err, &se) || se.Kind != scrape.SchemaViolation {
+		t.Fatalf("got %v, want a %v", err, scrape.SchemaViolation)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	window, lines := newTestWindow(t, 320)
+	window.Faults = simulator.Faults{Latency: 100 * time.Millisecond, Tearing: 30 * time.Millisecond}
+	s := newTestScraper(t, window)
+
+	var phases []string
+	counts := make(map[string]int)
+	var appended, rows int
+	s.Event = func(e events.Event) {
+		counts[e.Event]++
+		switch e.Event {
+		case events.PhaseChange:
+			phases = append(phases, e.Phase)
+		case events.LinesAppended:
+			appended += e.Lines
+			rows = e.Rows
+		}
+		if e.Phase == "" {
+			t.Fatalf("%v event has no phase", e.Event)
+		}
+	}
+	if err := scrapeAll(s); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLines(t, phases, []string{events.PhasePaging, events.PhaseSingleLine, events.PhaseVerification})
+	if appended != len(lines) || rows != len(lines) {
+		t.Fatalf("%v lines appended, to %v rows, want %v", appended, rows, len(lines))
+	}
+	for _, event := range []string{events.PageCaptured, events.Retry, events.Stall} {
+		if counts[event] == 0 {
+			t.Errorf("no %v events", event)
+		}
+	}
+	if counts[events.Warning] > 0 {
+		t.Errorf("%v warning events", counts[events.Warning])
+	}
+}
+
+func TestStitchWithoutIndex(t *testing.T) {
+	// the default schema without an Index, so that the pages are lined up by their pixels
+	noIndex := recognizer.DefaultSchema()
+	noIndex.Fields[1].Name = "Number"
+
+	for _, test := range []struct {
+		name       string
+		same, runs int // lines from same on drawn the same as the one before them, runs of them
+		faults     simulator.Faults
+		warnings   int
+		merged     int // identical rows taken as one
+	}{
+		{name: "distinct rows"},
+		{name: "identical rows in a page", same: 20, runs: 1},
+		// the first page ends with the first of the pair, so the second would line up with it as an overlap of one
+		{name: "identical rows either side of a page", same: testLinesShown, runs: 1},
+		{name: "page down of more than a page", faults: simulator.Faults{ShortPageDowns: map[int]int{3: 51}}},
+		// which no amount of scrolling back tells apart from fewer of them
+		{name: "identical rows in both pages", same: testLinesShown - 2, runs: 4, warnings: 1, merged: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			window, lines := newTestWindow(t, 180)
+			window.Faults = test.faults
+			for i := test.same; i < test.same+test.runs; i++ {
+				lines[i] = lines[i-1]
+			}
+			s := newSchemaScraper(t, window, noIndex)
+			var warnings []events.Event
+			s.Event = func(e events.Event) {
+				if e.Event == events.Warning {
+					warnings = append(warnings, e)
+				}
+			}
+			if err := scrapeAll(s); err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != test.warnings {
+				t.Fatalf("got %v warning events %+v, want %v", len(warnings), warnings, test.warnings)
+			}
+			if test.warnings == 0 {
+				checkLines(t, rowTexts(s.Rows), lines)
+				return
+			}
+			if warnings[0].Reason == "" {
+				t.Errorf("got a warning %+v, want one with a reason", warnings[0])
+			}
+			if len(s.Rows) != len(lines)-test.merged {
+				t.Errorf("scraped %v lines, want %v", len(s.Rows), len(lines)-test.merged)
+			}
+		})
+	}
+}
+
+func TestScrollGap(t *testing.T) {
+	window, _ := newTestWindow(t, 320)
+	lost := make(map[int]bool)
+	for scroll := 5; scroll < 100; scroll++ {
+		lost[scroll] = true // none of the line ups after the third page down (after Home) are acted on
+	}
+	window.Faults = simulator.Faults{ShortPageDowns: map[int]int{3: 51}, LostScrolls: lost}
+	s := newTestScraper(t, window)
+
+	err := scrapeAll(s)
+	var se *scrape.Error
+	if !errors.As(err, &se) || se.Kind != scrape.ScrollGap {
+		t.Fatalf("got %v, want a %v", err, scrape.ScrollGap)
+	}
+}
+
+func TestScrollBarEstimates(t *testing.T) {
+	for _, n := range []int{320, 1001, 5000} {
+		window, lines := newTestWindow(t, n)
+		s := newTestScraper(t, window)
+		s.Track = &scrape.Track{X: simulator.TrackX, Y: simulator.TrackY, Height: simulator.TrackHeight, Grip: simulator.GripColour}
+
+		var estimates []events.Event
+		s.Event = func(e events.Event) {
+			if e.Event == events.LinesAppended && e.Phase == events.PhasePaging {
+				estimates = append(estimates, e)
+			}
+		}
+		if err := scrapeAll(s); err != nil {
+			t.Fatal(err)
+		}
+
+		half := estimates[len(estimates)/2]
+		if half.TotalLines < len(lines)*95/100 || half.TotalLines > len(lines)*105/100 {
+			t.Errorf("%v lines : half way, estimated %v lines", n, half.TotalLines)
+		}
+		if half.ETAMS <= 0 || half.Percent < 25 || half.Percent > 75 {
+			t.Errorf("%v lines : half way, estimated %v%% done, %vms to go", n, half.Percent, half.ETAMS)
+		}
+		last := estimates[len(estimates)-1]
+		if last.TotalLines < len(lines)*98/100 || last.TotalLines > len(lines)*102/100 {
+			t.Errorf("%v lines : at the last page, estimated %v lines", n, last.TotalLines)
+		}
+	}
+}
+
+func TestGrip(t *testing.T) {
+	for _, test := range []struct {
+		grip     scrape.Grip
+		top      int
+		fraction float64
+		lines    int
+		bottom   bool
+	}{
+		{grip: scrape.Grip{Top: 0, Size: 100, Height: 1000}, top: 0, fraction: 0, lines: 500},
+		{grip: scrape.Grip{Top: 450, Size: 100, Height: 1000}, top: 2250, fraction: 0.5, lines: 4550},
+		{grip: scrape.Grip{Top: 900, Size: 100, Height: 1000}, top: 4450, fraction: 1, lines: 4500, bottom: true},
+		{grip: scrape.Grip{Top: 0, Size: 1000, Height: 1000}, top: 0, fraction: 1, lines: 50, bottom: true},
+	} {
+		if got := test.grip.Fraction(); got != test.fraction {
+			t.Errorf("%+v : fraction %v, want %v", test.grip, got, test.fraction)
+		}
+		if got := test.grip.Lines(test.top, 50); got != test.lines {
+			t.Errorf("%+v : %v lines, want %v", test.grip, got, test.lines)
+		}
+		if got := test.grip.AtBottom(); got != test.bottom {
+			t.Errorf("%+v : at the bottom %v, want %v", test.grip, got, test.bottom)
+		}
+	}
+}
+
+func TestEndOfDocument(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		lines  int
+		track  bool
+		faults simulator.Faults
+		want   string
+		paging bool // whether the end is found while paging, before any single line downs
+	}{
+		{name: "no scroll bar", lines: 180, want: scrape.EndLineDownNoChange},
+		{name: "one page", lines: 50, track: true, want: scrape.EndGripAtBottom, paging: true},
+		// a grip of a whole number of rows gets to the bottom of the track
+		{name: "grip at the bottom", lines: 500, track: true, want: scrape.EndGripAtBottom, paging: true},
+		// but one rounded down stops a row short of it
+		{name: "grip a row short", lines: 320, track: true, want: scrape.EndKeyMatchesPage, paging: true},
+		// the first page down puts the grip two rows short, 5 lines before the end
+		{name: "End key scrolls on", lines: 5000, track: true, faults: simulator.Faults{ShortPageDowns: map[int]int{1: 45}}, want: scrape.EndKeyMatchesPage, paging: true},
+		{name: "lost page down", lines: 180, track: true, faults: simulator.Faults{LostScrolls: map[int]bool{3: true}}, want: scrape.EndKeyMatchesPage},
+		// a line down that changes nothing while the grip is not at the bottom is clicked again, not taken as the end
+		{name: "lost line downs", lines: 180, track: true, faults: simulator.Faults{LostScrolls: map[int]bool{4: true, 6: true, 7: true, 9: true}}, want: scrape.EndKeyMatchesPage},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			window, lines := newTestWindow(t, test.lines)
+			window.Faults = test.faults
+			s := newTestScraper(t, window)
+			if test.track {
+				s.Track = &scrape.Track{X: simulator.TrackX, Y: simulator.TrackY, Height: simulator.TrackHeight, Grip: simulator.GripColour}
+			}
+
+			var reasons, phases []string
+			s.Event = func(e events.Event) {
+				switch e.Event {
+				case events.EndOfDocument:
+					reasons = append(reasons, e.Reason)
+				case events.PhaseChange:
+					phases = append(phases, e.Phase)
+				}
+			}
+			if err := scrapeAll(s); err != nil {
+				t.Fatal(err)
+			}
+
+			checkLines(t, rowTexts(s.Rows), lines)
+			checkLines(t, reasons, []string{test.want})
+			if s.EndReason() != test.want {
+				t.Errorf("got end reason %q, want %q", s.EndReason(), test.want)
+			}
+			if paging := phases[1] == events.PhaseVerification; paging != test.paging {
+				t.Errorf("got phases %v, want the end found while paging %v", phases, test.paging)
+			}
+		})
+	}
+}
+
+func TestLineDownsLost(t *testing.T) {
+	window, _ := newTestWindow(t, 180)
+	lost := map[int]bool{4: true} // the third page down, so that the rest are scrolled to a line at a time
+	for scroll := 6; scroll < 20; scroll++ {
+		lost[scroll] = true // and from the second line down on, none are acted on
+	}
+	window.Faults = simulator.Faults{LostScrolls: lost}
+	s := newTestScraper(t, window)
+	s.Track = &scrape.Track{X: simulator.TrackX, Y: simulator.TrackY, Height: simulator.TrackHeight, Grip: simulator.GripColour}
+
+	// which, with the grip not at the bottom, is not the end of the document
+	err := scrapeAll(s)
+	var se *scrape.Error
+	if !errors.As(err, &se) || se.Kind != scrape.CaptureFailure || !strings.Contains(err.Error(), "6 line downs in a row") {
+		t.Fatalf("got %v, want a %v after 6 line downs", err, scrape.CaptureFailure)
+	}
+	if s.EndReason() != "" {
+		t.Errorf("got end reason %q, want none", s.EndReason())
+	}
+}
+
+func TestResume(t *testing.T) {
+	faults := simulator.Faults{
+		ShortPageDowns: map[int]int{5: 1},
+		LostScrolls:    map[int]bool{7: true}, // the sixth page down, leaving 69 lines to be scrolled to a line at a time
+	}
+	for _, stopAfter := range []int{1, 3, 6, 7, 40} { // pages (and single lines) confirmed
+		window, lines := newTestWindow(t, 320)
+		window.Faults = faults
+		s := newTestScraper(t, window)
+
+		var confirmed []recognizer.Row
+		var last *scrape.Checkpoint
+		s.Confirmed = func(rows []recognizer.Row, cp *scrape.Checkpoint) error {
+			confirmed = append(confirmed, rows...)
+			last = cp
+			return nil
+		}
+		s.Stopped = func() bool { return last != nil && last.Pages >= stopAfter }
+		if err := s.Run(); !errors.Is(err, scrape.ErrUserExit) {
+			t.Fatalf("stopping after %v : got %v, want %v", stopAfter, err, scrape.ErrUserExit)
+		}
+
+		// start again, with only the checkpoint
+		window, _ = newTestWindow(t, 320)
+		window.Faults = faults
+		s = newTestScraper(t, window)
+		s.ResumeFrom(last)
+		s.Confirmed = func(rows []recognizer.Row, cp *scrape.Checkpoint) error {
+			confirmed = append(confirmed, rows...)
+			return nil
+		}
+		if err := scrapeAll(s); err != nil {
+			t.Fatalf("resuming after %v : %v", stopAfter, err)
+		}
+		checkLines(t, rowTexts(confirmed), lines)
+	}
+}
+
+func TestResumeCheckpointNotFound(t *testing.T) {
+	window, _ := newTestWindow(t, 120)
+	s := newTestScraper(t, window)
+	s.ResumeFrom(&scrape.Checkpoint{Phase: scrape.PhasePages, Pages: 2, LastHashes: []string{"not on screen"}})
+
+	err := s.Run()
+	var se *scrape.Error
+	if !errors.As(err, &se) || se.Kind != scrape.CheckpointNotFound || !errors.Is(err, scrape.ErrCheckpointNotFound) {
+		t.Fatalf("got %v, want a %v", err, scrape.CheckpointNotFound)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	window, lines := newTestWindow(t, 120)
+	s := newTestScraper(t, window)
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lastLines, err := s.LastPages(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, rowTexts(lastLines), reversed(lines[len(lines)-testLinesShown:]))
+
+	s.Rows = s.Rows[:len(s.Rows)-1] // as if the last line was missed
+	err = s.Verify(lastLines)
+	var se *scrape.Error
+	if !errors.As(err, &se) || se.Kind != scrape.VerificationMismatch || !strings.Contains(err.Error(), lines[len(lines)-1]) {
+		t.Fatalf("got %v, want a %v about %q", err, scrape.VerificationMismatch, lines[len(lines)-1])
+	}
+}
+
+func reversed(lines []string) []string {
+	r := make([]string, len(lines))
+	for i, line := range lines {
+		r[len(lines)-1-i] = line
+	}
+	return r
+}
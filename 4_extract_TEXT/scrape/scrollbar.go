@@ -0,0 +1,120 @@
+package scrape
+
+// Where the grip of the scroll bar is says how far through the document the window is, and how big
+// it is says how much of the document a page is, so from them the length of the document, and how
+// long the rest of it will take, can be estimated before the end is reached.
+
+import (
+	"encoding/binary"
+	"image"
+	"time"
+)
+
+// Track is where the grip of the scroll bar moves, in a ScreenSource: a column of pixels down it.
+type Track struct {
+	X, Y   int    // top of the column
+	Height int    // rows of pixels the grip can be in, from its top at the top of the document to its bottom at the end
+	Grip   uint32 // colour of the grip, 0xRRGGBB
+}
+
+// Grip is where the grip was found in its Track, in rows of pixels.
+type Grip struct {
+	Top    int // from the top of the track
+	Size   int
+	Height int // of the track
+}
+
+// Fraction is how far the grip has moved down the track, 0 at the top and 1 at the bottom.
+func (g Grip) Fraction() float64 {
+	if g.Size >= g.Height {
+		return 1 // the whole document fits on a page
+	}
+	return float64(g.Top) / float64(g.Height-g.Size)
+}
+
+// AtBottom is true when the grip is at the bottom of its track.
+func (g Grip) AtBottom() bool {
+	return g.Top+g.Size >= g.Height
+}
+
+// Lines estimates how many lines the document has, with line 'top' (the first is 0) at the top of the
+// window showing 'shown' lines. Until the grip has moved far enough down the track for where it is to
+// say, it is taken from the size of the grip, which is less accurate, and which a minimum size of
+// grip makes an underestimate of a long document.
+func (g Grip) Lines(top int, shown int) int {
+	const minMove = 10 // rows of pixels, for the position to be known to within 10%
+	if g.Top >= minMove {
+		return shown + int(float64(top)/g.Fraction()+0.5)
+	}
+	if g.Size <= 0 || g.Size >= g.Height {
+		return shown
+	}
+	return shown * g.Height / g.Size
+}
+
+// nearBottom is true when the grip last measured is a row or two short of the bottom of its track, as
+// one drawn at rounded down positions may be at the end of the document, and those rows are less than a
+// page of lines.
+func (s *Scraper) nearBottom() bool {
+	const maxRows = 2
+	g := s.grip
+	rows := g.Height - g.Top - g.Size
+	done := s.rowsBefore + len(s.Rows)
+	if !s.gripOK || rows <= 0 || rows > maxRows || g.Size >= g.Height || done < s.area.Lines {
+		return false
+	}
+	lines := g.Lines(done-s.area.Lines, s.area.Lines)
+	linesPerRow := float64(lines-s.area.Lines) / float64(g.Height-g.Size)
+	return float64(rows)*linesPerRow < float64(s.area.Lines)
+}
+
+// measureGrip grabs the track and finds the grip in it: the rows of the grip's colour, from the first
+// to the last. ok is false if there is no track, or the grip is not in it.
+func (s *Scraper) measureGrip() (grip Grip, ok bool) {
+	t := s.Track
+	if t == nil {
+		return Grip{}, false
+	}
+	column, err := s.source.Grab(image.Rect(t.X, t.Y, t.X+1, t.Y+t.Height))
+	if err != nil {
+		s.logf("Grab of the scroll bar FAIL : %v", err)
+		return Grip{}, false
+	}
+	first, last := -1, -1
+	for y := 0; y*4+4 <= len(column); y++ {
+		if binary.LittleEndian.Uint32(column[y*4:])&0xFFFFFF == t.Grip {
+			if first < 0 {
+				first = y
+			}
+			last = y
+		}
+	}
+	if first < 0 {
+		return Grip{}, false
+	}
+	return Grip{Top: first, Size: last - first + 1, Height: t.Height}, true
+}
+
+// estimate is how long the document is thought to be, from the grip last measured, with 'done' rows of
+// it scraped.
+type estimate struct {
+	lines   int
+	percent float64
+	eta     time.Duration
+}
+
+func (s *Scraper) estimate(done int) (estimate, bool) {
+	if !s.gripOK || done < s.area.Lines {
+		return estimate{}, false
+	}
+	e := estimate{lines: s.grip.Lines(done-s.area.Lines, s.area.Lines)}
+	if e.lines < done {
+		e.lines = done
+	}
+	e.percent = 100 * float64(done) / float64(e.lines)
+	if scraped := done - s.rowsBefore; scraped > 0 {
+		elapsed := s.Now().Sub(s.started)
+		e.eta = time.Duration(float64(elapsed) * float64(e.lines-done) / float64(scraped))
+	}
+	return e, true
+}
@@ -0,0 +1,125 @@
+package scrape
+
+// Page stitching : rather than trusting each PageDown to scroll exactly linesShown lines, each new
+// page is lined up against the one before it, and only the lines that scrolled into view are kept.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// indexFieldName is the schema field that, when there is one, numbers the rows.
+const indexFieldName = "Index"
+
+// stitcher works out how far the window scrolled between two pages.
+type stitcher struct {
+	index int // of the schema's indexFieldName field, -1 if it has none
+}
+
+func newStitcher(schema *recognizer.Schema) *stitcher {
+	st := &stitcher{index: -1}
+	for i, f := range schema.Fields {
+		if strings.EqualFold(f.Name, indexFieldName) {
+			st.index = i
+		}
+	}
+	return st
+}
+
+// newLines returns how many lines at the end of next, the page on screen, scrolled into view since
+// prev, the page before it. Each page is given as its rows and the pixel hashes of its lines. ok is
+// false when the pages do not overlap enough to be sure that no lines were scrolled past between them,
+// and warning is not "" when they could not be lined up for sure, and says why.
+//
+// With an Index field the rows are lined up by it, so that rows which are otherwise the same are
+// still told apart, and a page that does not overlap the one before must start with the Index that
+// follows on from it. Without one the largest overlap of line hashes is taken, which must be at least
+// 2 lines, as a single line could be identical rows either side of the bottom of a page, and no
+// overlap at all could be a page down of more than a page. Identical rows that are in both pages can
+// still be taken as one, which is warned of when a smaller overlap would also line the pages up.
+func (st *stitcher) newLines(prev []recognizer.Row, prevHashes []string, next []recognizer.Row, nextHashes []string) (n int, ok bool, warning string) {
+	if len(prev) == 0 {
+		return len(next), true, ""
+	}
+
+	if st.index >= 0 {
+		first, ok := st.indexOf(next[0])
+		if !ok {
+			return len(next), true, ""
+		}
+		for i := range prev {
+			if index, ok := st.indexOf(prev[i]); ok && index == first && sameRows(prev[i:], next) {
+				return len(next) - (len(prev) - i), true, ""
+			}
+		}
+		return len(next), st.followsOn(prev, next), ""
+	}
+
+	largest := 0
+	for overlap := len(next) - 1; overlap > 0; overlap-- {
+		if overlap > len(prevHashes) || !sameStrings(prevHashes[len(prevHashes)-overlap:], nextHashes[:overlap]) {
+			continue
+		}
+		if largest > 0 {
+			return len(next) - largest, true, fmt.Sprintf("the pages line up with %v or %v lines in common, identical rows may have been taken as one", largest, overlap)
+		}
+		largest = overlap
+	}
+	return len(next) - largest, largest >= 2, ""
+}
+
+func (st *stitcher) indexOf(row recognizer.Row) (string, bool) {
+	if st.index >= len(row.Fields) {
+		return "", false
+	}
+	return row.Fields[st.index], true
+}
+
+// followsOn is true unless the Index of the first row of next is known not to follow on from prev, as
+// it does not when a page down scrolls more than a page and rows are missed out.
+func (st *stitcher) followsOn(prev []recognizer.Row, next []recognizer.Row) bool {
+	if len(prev) < 2 {
+		return true
+	}
+	var indices [3]int64
+	for i, row := range []recognizer.Row{prev[len(prev)-2], prev[len(prev)-1], next[0]} {
+		field, ok := st.indexOf(row)
+		if !ok {
+			return true
+		}
+		var err error
+		if indices[i], err = strconv.ParseInt(field, 10, 64); err != nil {
+			return true
+		}
+	}
+	before, last, first := indices[0], indices[1], indices[2]
+	return first-last == last-before
+}
+
+// sameRows is true if the rows of a, up to the length of the shorter, are the same text as those of b.
+func sameRows(a []recognizer.Row, b []recognizer.Row) bool {
+	if len(a) > len(b) {
+		a = a[:len(b)]
+	}
+	for i := range a {
+		if a[i].Text != b[i].Text {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package scrape
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/recognizer"
+)
+
+// testPage is the rows of a page, each given as its comma separated fields, with its text
+// standing in for the pixel hash of its line.
+func testPage(lines ...string) ([]recognizer.Row, []string) {
+	rows := make([]recognizer.Row, len(lines))
+	for i, line := range lines {
+		rows[i] = recognizer.Row{Text: line, Fields: strings.Split(line, ",")}
+	}
+	return rows, lines
+}
+
+func TestNewLines(t *testing.T) {
+	// the default schema without an Index, so that the pages are lined up by their hashes
+	noIndex := recognizer.DefaultSchema()
+	noIndex.Fields[1].Name = "Number"
+
+	tests := []struct {
+		name    string
+		schema  *recognizer.Schema
+		prev    []string
+		next    []string
+		want    int
+		ok      bool
+		warning bool
+	}{
+		{"index overlap", recognizer.DefaultSchema(),
+			[]string{"t,1,a", "t,2,a", "t,3,a", "t,4,a"}, []string{"t,3,a", "t,4,a", "t,5,a", "t,6,a"}, 2, true, false},
+		{"index follows on", recognizer.DefaultSchema(),
+			[]string{"t,1,a", "t,2,a", "t,3,a", "t,4,a"}, []string{"t,5,a", "t,6,a", "t,7,a", "t,8,a"}, 4, true, false},
+		{"index gap", recognizer.DefaultSchema(),
+			[]string{"t,1,a", "t,2,a", "t,3,a", "t,4,a"}, []string{"t,7,a", "t,8,a", "t,9,a", "t,10,a"}, 4, false, false},
+		{"hash overlap", noIndex,
+			[]string{"t,1,a", "t,2,a", "t,3,a", "t,4,a"}, []string{"t,3,a", "t,4,a", "t,5,a", "t,6,a"}, 2, true, false},
+		// one line in common could be identical rows either side of the bottom of a page
+		{"hash overlap of one", noIndex,
+			[]string{"t,1,a", "t,2,a", "t,3,a", "t,4,a"}, []string{"t,4,a", "t,5,a", "t,6,a", "t,7,a"}, 3, false, false},
+		// and none could be a page down of more than a page
+		{"no hash overlap", noIndex,
+			[]string{"t,1,a", "t,2,a", "t,3,a", "t,4,a"}, []string{"t,5,a", "t,6,a", "t,7,a", "t,8,a"}, 4, false, false},
+		{"identical rows", noIndex,
+			[]string{"t,1,a", "t,2,a", "t,x,a", "t,x,a"}, []string{"t,x,a", "t,x,a", "t,5,a", "t,6,a"}, 2, true, true},
+	}
+	for _, test := range tests {
+		prev, prevHashes := testPage(test.prev...)
+		next, nextHashes := testPage(test.next...)
+		n, ok, warning := newStitcher(test.schema).newLines(prev, prevHashes, next, nextHashes)
+		if ok != test.ok || (ok && n != test.want) || (warning != "") != test.warning {
+			t.Errorf("%v : got %v, %v, %q, want %v, %v, warning %v", test.name, n, ok, warning, test.want, test.ok, test.warning)
+		}
+	}
+}
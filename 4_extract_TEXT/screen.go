@@ -0,0 +1,25 @@
+package main
+
+// Screen sources : grabbing the pixels of the window being scraped from the X server.
+
+import (
+	"image"
+
+	"github.com/robotn/xgb"
+	"github.com/robotn/xgb/xproto"
+)
+
+// x11Source grabs from an X11 drawable, either the root window (the whole screen) or the window
+// being scraped, in the drawable's own co-ordinates.
+type x11Source struct {
+	c        *xgb.Conn
+	drawable xproto.Drawable
+}
+
+func (x *x11Source) Grab(r image.Rectangle) ([]byte, error) {
+	xImg, err := xproto.GetImage(x.c, xproto.ImageFormatZPixmap, x.drawable, int16(r.Min.X), int16(r.Min.Y), uint16(r.Dx()), uint16(r.Dy()), 0xffffffff).Reply()
+	if err != nil {
+		return nil, err
+	}
+	return xImg.Data, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+// Scroll drivers : how the window being scraped is told to scroll, either by clicking on its
+// scroll bar or by sending it keys.
+
+import (
+	"fmt"
+
+	"github.com/go-vgo/robotgo"
+	"github.com/redhug1/BitmapTextScrape/4_extract_TEXT/scrape"
+)
+
+// Scroll drivers that can be chosen with 'ScrollDriver' in the config file, or -scroll.
+const (
+	scrollMouse = "mouse" // click on the profile's LineUp, LineDown, PageUp and PageDown
+	scrollKeys  = "keys"  // send Home, Up, Down, PageUp and PageDown to the focused window
+)
+
+// newScroller returns the scroll driver called name, for the window whose anchor is at anchorX, anchorY.
+func newScroller(name string, anchorX int, anchorY int, pageDownOffset int) (scrape.Scroller, error) {
+	switch name {
+	case scrollMouse, "":
+		m := &mouseScroller{pageDownOffset: pageDownOffset}
+		m.lineUpX, m.lineUpY = profile.LineUp.at(anchorX, anchorY)
+		m.lineDownX, m.lineDownY = profile.LineDown.at(anchorX, anchorY)
+		m.pageUpX, m.pageUpY = profile.PageUp.at(anchorX, anchorY)
+		m.pageDownX, m.pageDownY = profile.PageDown.at(anchorX, anchorY)
+		m.endX, m.endY = m.pageDownX, m.pageDownY-pageDownOffset
+		if t := profile.ScrollTrack; t != nil {
+			m.endX, m.endY = point{X: t.X, Y: t.Y + t.Height - 1}.at(anchorX, anchorY)
+		}
+		return m, nil
+	case scrollKeys:
+		return keyScroller{}, nil
+	}
+	return nil, fmt.Errorf("scroll driver %q is not one of %v or %v", name, scrollMouse, scrollKeys)
+}
+
+// mouseScroller clicks on the scroll bar. Where a page down is clicked depends on where the grip
+// is, so 'PageDownOffset' may need increasing for smaller amounts of data.
+type mouseScroller struct {
+	lineUpX, lineUpY     int
+	lineDownX, lineDownY int
+	pageUpX, pageUpY     int
+	pageDownX, pageDownY int
+	pageDownOffset       int
+	endX, endY           int // the bottom row of the profile's 'ScrollTrack', or where a page down is clicked
+}
+
+// Home clicks the up arrow once, as the window is expected to be at (or near) the top already.
+func (m *mouseScroller) Home() {
+	m.LineUp()
+}
+
+// End clicks the bottom row of the scroll track. The scrape only scrolls to the end when the grip is a
+// row or two short of there, with less than a page of lines to go, or when a line down has changed
+// nothing, so the click is below the grip and the page down it makes goes to the end; if the grip is
+// already at the bottom it is clicked on, which does nothing. Without a 'ScrollTrack' it is a page
+// down, which also changes nothing at the end.
+func (m *mouseScroller) End() {
+	m.click(m.endX, m.endY)
+}
+
+func (m *mouseScroller) LineUp() {
+	m.click(m.lineUpX, m.lineUpY)
+}
+
+func (m *mouseScroller) LineDown() {
+	m.click(m.lineDownX, m.lineDownY)
+}
+
+func (m *mouseScroller) PageUp() {
+	m.click(m.pageUpX, m.pageUpY)
+}
+
+func (m *mouseScroller) PageDown() {
+	m.click(m.pageDownX, m.pageDownY-m.pageDownOffset)
+}
+
+func (m *mouseScroller) click(x int, y int) {
+	robotgo.MoveMouse(x, y)
+	robotgo.Click("left", false) // 'false' for single click, 'true' for double click
+}
+
+// keyScroller sends keys to the window that has the focus, so it does not matter where the
+// grip of the scroll bar is. The mouse is left where it is.
+type keyScroller struct{}
+
+func (keyScroller) Home()     { robotgo.KeyTap("home") }
+func (keyScroller) End()      { robotgo.KeyTap("end") }
+func (keyScroller) LineUp()   { robotgo.KeyTap("up") }
+func (keyScroller) LineDown() { robotgo.KeyTap("down") }
+func (keyScroller) PageUp()   { robotgo.KeyTap("pageup") }
+func (keyScroller) PageDown() { robotgo.KeyTap("pagedown") }
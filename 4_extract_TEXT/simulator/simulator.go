@@ -0,0 +1,393 @@
+// Package simulator is an in-memory stand in for 3_scroll_window_Mock, so that a scrape can be tested
+// without an X display. A Window draws the lines of the mock data with the mock's font bitmaps, is
+// scrolled like the mock by the methods of a scrape.Scroller and grabbed by that of a scrape.ScreenSource,
+// and can be made to misbehave with Faults. Time is simulated too, moved on only by Sleep.
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The size of a line of the mock, as grabbed by the extractor.
+const (
+	LineWidth = 532
+	LinePitch = 18
+)
+
+// The scroll bar of the mock, as a column of pixels down the middle of the rows its grip is filled in
+// (between its border rows) from the top of the track to the bottom, relative to the first line.
+const (
+	TrackX      = 540
+	TrackY      = 16
+	TrackHeight = 868
+	GripColour  = 0xffff00
+)
+
+// The grip of the mock, see scrollGripSize and calcScrollBarPos of 3_scroll_window_Mock.
+const (
+	gripBorder  = 0x00007f
+	gripMinSize = 8
+	trackSize   = TrackHeight + 2 // the grip's border rows go over the ends of the track
+)
+
+// The positions of the mock's field separators, less the 1 pixel the grab starts in by.
+var separators = []int{105, 202, 314, 441}
+
+// Font is the mock's font bitmaps, and the background of a line they are drawn on.
+type Font struct {
+	background image.Image
+	glyphs     map[byte]image.Image
+	widths     map[byte]int
+}
+
+// LoadFont reads the font of 2_create_font_PNGs: its description file, the directory of its
+// bitmaps, and the line background of 3_scroll_window_Mock.
+func LoadFont(descriptionFile string, fontDir string, backgroundFile string) (*Font, error) {
+	data, err := ioutil.ReadFile(descriptionFile)
+	if err != nil {
+		return nil, err
+	}
+	var fonts []struct {
+		Character    string
+		Width        int
+		FontFileName string
+	}
+	if err = json.Unmarshal(data, &fonts); err != nil {
+		return nil, fmt.Errorf("%v : %v", descriptionFile, err)
+	}
+
+	f := &Font{glyphs: make(map[byte]image.Image), widths: make(map[byte]int)}
+	if f.background, err = readPNG(backgroundFile); err != nil {
+		return nil, err
+	}
+	for _, font := range fonts {
+		if len(font.Character) != 1 {
+			return nil, fmt.Errorf("%v : character %q is not a single byte", descriptionFile, font.Character)
+		}
+		c := font.Character[0]
+		if f.glyphs[c], err = readPNG(filepath.Join(fontDir, font.FontFileName)); err != nil {
+			return nil, err
+		}
+		f.widths[c] = font.Width
+	}
+	return f, nil
+}
+
+func readPNG(fileName string) (image.Image, error) {
+	infile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+	img, err := png.Decode(infile)
+	if err != nil {
+		return nil, fmt.Errorf("%v : %v", fileName, err)
+	}
+	return img, nil
+}
+
+// ReadLines reads up to max lines of a data file such as 1_mock_data/mock_data.csv, 0 for all of them.
+func ReadLines(fileName string, max int) ([]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && (max == 0 || len(lines) < max) {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func (f *Font) textWidth(text string) int {
+	var width int
+	for i := 0; i < len(text); i++ {
+		width += f.widths[text[i]]
+	}
+	return width
+}
+
+func (f *Font) text(dst *image.RGBA, x int, text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		draw.Draw(dst, image.Rect(x, 0, x+f.widths[c], LinePitch), f.glyphs[c], image.Point{}, draw.Src)
+		x += f.widths[c]
+	}
+}
+
+// render returns a line of mock data, e.g. "00:00:00,1,4,20,1", drawn as the mock does it, as pixels
+// in the X11 ZPixmap order.
+func (f *Font) render(line string) []byte {
+	dst := image.NewRGBA(image.Rect(0, 0, LineWidth, LinePitch))
+	draw.Draw(dst, dst.Bounds(), f.background, image.Point{}, draw.Src)
+
+	if parts := strings.Split(line, ","); len(parts) == 5 {
+		f.text(dst, 1, parts[0])
+		for _, x := range separators {
+			f.text(dst, x, "|")
+		}
+		f.text(dst, separators[1]-1-f.textWidth(parts[1]), parts[1])
+		f.text(dst, separators[2]-1-f.textWidth(parts[2]), parts[2])
+		f.text(dst, separators[3]-1-f.textWidth(parts[3]), parts[3])
+		f.text(dst, LineWidth-1-f.textWidth(parts[4]), parts[4])
+	}
+
+	pix := make([]byte, LineWidth*LinePitch*4)
+	for i := 0; i < LineWidth*LinePitch; i++ {
+		pix[i*4] = dst.Pix[i*4+2] // RGBA to BGRX
+		pix[i*4+1] = dst.Pix[i*4+1]
+		pix[i*4+2] = dst.Pix[i*4]
+	}
+	return pix
+}
+
+// Faults are the ways a Window can be made to misbehave, none by default.
+type Faults struct {
+	// Latency is how long after a scroll the window is drawn scrolled.
+	Latency time.Duration
+
+	// Tearing is how long after the window is drawn scrolled grabs see only its top half drawn,
+	// as if grabbed part way through the update.
+	Tearing time.Duration
+
+	// ShortPageDowns maps the number of a page down (the first is 1) to the lines it scrolls, rather than a page.
+	ShortPageDowns map[int]int
+
+	// LostScrolls are the numbers of the scrolls (of any kind, the first is 1) that are not acted on,
+	// e.g. because the click landed on the grip of the scroll bar.
+	LostScrolls map[int]bool
+
+	// FailGrab is the number of the grab (the first is 1) that returns an error, 0 for none.
+	FailGrab int
+
+	// BlackLines are the indices of the lines of data drawn all black.
+	BlackLines map[int]bool
+}
+
+// pendingScroll is a scroll not yet drawn.
+type pendingScroll struct {
+	at  time.Duration // when it is drawn
+	top int           // line at the top of the window once it is
+}
+
+// Window is the simulated scroll window.
+type Window struct {
+	Faults Faults
+
+	font  *Font
+	lines []string
+	shown int // lines on a page
+
+	mu        sync.Mutex
+	rendered  map[int][]byte // line index to pixels
+	clock     time.Duration
+	top       int           // line at the top of the window, as drawn
+	wantTop   int           // line at the top once the pending scrolls are drawn
+	lastTop   int           // line at the top before the last scroll drawn, for torn grabs
+	tornUntil time.Duration // when the last scroll drawn is drawn all the way down
+	pending   []pendingScroll
+	scrolls   int
+	pageDowns int
+	grabs     int
+}
+
+// New returns a Window of lines, shown 'shown' at a time, at the top.
+func New(font *Font, lines []string, shown int) *Window {
+	return &Window{font: font, lines: lines, shown: shown, rendered: make(map[int][]byte)}
+}
+
+// Top is the index of the line drawn at the top of the window.
+func (w *Window) Top() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.top
+}
+
+// Grabs is how many times the window has been grabbed.
+func (w *Window) Grabs() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.grabs
+}
+
+// Elapsed is the simulated time that has passed.
+func (w *Window) Elapsed() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.clock
+}
+
+// Now is the simulated time.
+func (w *Window) Now() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Unix(0, 0).Add(w.clock)
+}
+
+// Sleep moves the simulated time on by d, drawing any scrolls that are due.
+func (w *Window) Sleep(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clock += d
+	w.draw()
+}
+
+// draw draws the scrolls that are due.
+func (w *Window) draw() {
+	for len(w.pending) > 0 && w.pending[0].at <= w.clock {
+		if w.pending[0].top != w.top {
+			w.lastTop, w.top = w.top, w.pending[0].top
+			w.tornUntil = w.pending[0].at + w.Faults.Tearing
+		}
+		w.pending = w.pending[1:]
+	}
+}
+
+// scrollTo scrolls the window so that line top is at the top, as far as it can go.
+func (w *Window) scrollTo(top int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.scrolls++
+	if w.Faults.LostScrolls[w.scrolls] {
+		return
+	}
+	if last := len(w.lines) - w.shown; top > last {
+		top = last
+	}
+	if top < 0 {
+		top = 0
+	}
+	w.wantTop = top
+	w.pending = append(w.pending, pendingScroll{at: w.clock + w.Faults.Latency, top: top})
+	w.draw()
+}
+
+// Home scrolls to the first line, like the mock's Home key.
+func (w *Window) Home() { w.scrollTo(0) }
+
+// End scrolls to the last page, like the mock's End key.
+func (w *Window) End() { w.scrollTo(len(w.lines)) }
+
+// LineUp scrolls up a line.
+func (w *Window) LineUp() { w.scrollTo(w.target() - 1) }
+
+// LineDown scrolls down a line.
+func (w *Window) LineDown() { w.scrollTo(w.target() + 1) }
+
+// PageUp scrolls up a page.
+func (w *Window) PageUp() { w.scrollTo(w.target() - w.shown) }
+
+// PageDown scrolls down a page, or the lines of Faults.ShortPageDowns.
+func (w *Window) PageDown() {
+	w.mu.Lock()
+	w.pageDowns++
+	lines, short := w.Faults.ShortPageDowns[w.pageDowns]
+	w.mu.Unlock()
+	if !short {
+		lines = w.shown
+	}
+	w.scrollTo(w.target() + lines)
+}
+
+// target is the line that will be at the top once the scrolls so far are drawn, which is where the
+// mock scrolls on from.
+func (w *Window) target() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wantTop
+}
+
+// Grab returns the pixels of r, which is relative to the top left of the first line shown. It is in the
+// lines shown, or in the column of the scroll bar's track.
+func (w *Window) Grab(r image.Rectangle) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.grabs++
+	if w.grabs == w.Faults.FailGrab {
+		return nil, fmt.Errorf("grab %v failed, as asked", w.grabs)
+	}
+	if r.In(image.Rect(TrackX, TrackY, TrackX+1, TrackY+TrackHeight)) {
+		return w.track(r.Min.Y-TrackY, r.Max.Y-TrackY), nil
+	}
+	if !r.In(image.Rect(0, 0, LineWidth, LinePitch*w.shown)) {
+		return nil, fmt.Errorf("%v is not inside the window", r)
+	}
+
+	tearing := w.clock < w.tornUntil
+
+	pix := make([]byte, 0, r.Dx()*r.Dy()*4)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		lineTop := w.top
+		if tearing && y >= LinePitch*w.shown/2 {
+			lineTop = w.lastTop
+		}
+		line := w.line(lineTop + y/LinePitch)
+		row := (y % LinePitch) * LineWidth * 4
+		pix = append(pix, line[row+r.Min.X*4:row+r.Max.X*4]...)
+	}
+	return pix, nil
+}
+
+// track returns the pixels of rows from to to of the track, with the grip drawn where the mock draws it.
+func (w *Window) track(from int, to int) []byte {
+	gripSize := trackSize * float32(w.shown) / float32(len(w.lines))
+	if gripSize < gripMinSize {
+		gripSize = gripMinSize
+	}
+	if gripSize > trackSize {
+		gripSize = trackSize
+	}
+	scrollable := float32(len(w.lines) - w.shown)
+	if scrollable < 1 {
+		scrollable = 1
+	}
+	offset := int((trackSize - gripSize) * (float32(w.top) / scrollable))
+	size := int(gripSize)
+
+	pix := make([]byte, 0, (to-from)*4)
+	for y := from; y < to; y++ {
+		var colour uint32 // the track is black
+		switch y + 1 {    // from the top of the grip's border rows
+		case offset, offset + size - 1:
+			colour = gripBorder
+		default:
+			if y+1 > offset && y+1 < offset+size-1 {
+				colour = GripColour
+			}
+		}
+		pix = append(pix, byte(colour), byte(colour>>8), byte(colour>>16), 0)
+	}
+	return pix
+}
+
+// line returns the pixels of line index, rendering it the first time.
+func (w *Window) line(index int) []byte {
+	if pix, ok := w.rendered[index]; ok {
+		return pix
+	}
+	var pix []byte
+	switch {
+	case w.Faults.BlackLines[index]:
+		pix = make([]byte, LineWidth*LinePitch*4)
+	case index < len(w.lines):
+		pix = w.font.render(w.lines[index])
+	default:
+		pix = w.font.render("")
+	}
+	w.rendered[index] = pix
+	return pix
+}
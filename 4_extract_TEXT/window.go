@@ -0,0 +1,210 @@
+package main
+
+// Target windows : picking the window to scrape by its X11 id or title, so that it is grabbed from
+// its own drawable rather than found by searching a capture of the whole screen for the anchor image.
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/robotn/xgb"
+	"github.com/robotn/xgb/xproto"
+)
+
+// xWindow is the window being scraped, when it is picked with -window-id or -window-name.
+type xWindow struct {
+	id     xproto.Window
+	name   string
+	x, y   int // of its top left corner on screen
+	width  int
+	height int
+}
+
+// targetWindow returns the window with the X11 id idText (e.g. 0x3a00007, as shown by xwininfo),
+// or if that is "" the one titled name.
+func targetWindow(c *xgb.Conn, root xproto.Window, idText string, name string) (*xWindow, error) {
+	if idText != "" && name != "" {
+		return nil, fmt.Errorf("use one of -window-id or -window-name, not both")
+	}
+	var win *xWindow
+	if idText != "" {
+		id, err := strconv.ParseUint(idText, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("window id %q : %v", idText, err)
+		}
+		win = &xWindow{id: xproto.Window(id)}
+		if win.name, err = windowName(c, win.id); err != nil {
+			return nil, fmt.Errorf("window %#x : %v", id, err)
+		}
+	} else {
+		var err error
+		if win, err = findWindow(c, root, name); err != nil {
+			return nil, err
+		}
+	}
+	if err := win.geometry(c, root); err != nil {
+		return nil, err
+	}
+	return win, nil
+}
+
+// findWindow returns the viewable window whose title is name or, if there is none, the only one
+// whose title contains name.
+func findWindow(c *xgb.Conn, root xproto.Window, name string) (*xWindow, error) {
+	windows, err := viewableWindows(c, root)
+	if err != nil {
+		return nil, err
+	}
+	var partial []*xWindow
+	for _, win := range windows {
+		if win.name == name {
+			return win, nil
+		}
+		if strings.Contains(win.name, name) {
+			partial = append(partial, win)
+		}
+	}
+	switch len(partial) {
+	case 0:
+		return nil, fmt.Errorf("no window is titled %q", name)
+	case 1:
+		return partial[0], nil
+	}
+	titles := make([]string, len(partial))
+	for i, win := range partial {
+		titles[i] = fmt.Sprintf("%#x %q", uint32(win.id), win.name)
+	}
+	return nil, fmt.Errorf("%v windows have titles containing %q, use -window-id with one of : %v", len(partial), name, strings.Join(titles, ", "))
+}
+
+// viewableWindows returns every window under parent that is on screen and has a title.
+func viewableWindows(c *xgb.Conn, parent xproto.Window) ([]*xWindow, error) {
+	tree, err := xproto.QueryTree(c, parent).Reply()
+	if err != nil {
+		return nil, err
+	}
+	var windows []*xWindow
+	for _, child := range tree.Children {
+		attributes, err := xproto.GetWindowAttributes(c, child).Reply()
+		if err != nil || attributes.MapState != xproto.MapStateViewable {
+			continue // gone, or not shown
+		}
+		if name, err := windowName(c, child); err == nil && name != "" {
+			windows = append(windows, &xWindow{id: child, name: name})
+		}
+		below, err := viewableWindows(c, child)
+		if err != nil {
+			continue
+		}
+		windows = append(windows, below...)
+	}
+	return windows, nil
+}
+
+// windowName returns the title of a window, its _NET_WM_NAME or, for applications that do not set
+// that, its WM_NAME.
+func windowName(c *xgb.Conn, win xproto.Window) (string, error) {
+	netWMName, err := internAtom(c, "_NET_WM_NAME")
+	if err != nil {
+		return "", err
+	}
+	utf8String, err := internAtom(c, "UTF8_STRING")
+	if err != nil {
+		return "", err
+	}
+	reply, err := xproto.GetProperty(c, false, win, netWMName, utf8String, 0, 1024).Reply()
+	if err != nil {
+		return "", err
+	}
+	if reply.ValueLen == 0 {
+		if reply, err = xproto.GetProperty(c, false, win, xproto.AtomWmName, xproto.AtomString, 0, 1024).Reply(); err != nil {
+			return "", err
+		}
+	}
+	return string(reply.Value), nil
+}
+
+var atoms = map[string]xproto.Atom{}
+
+func internAtom(c *xgb.Conn, name string) (xproto.Atom, error) {
+	if atom, ok := atoms[name]; ok {
+		return atom, nil
+	}
+	reply, err := xproto.InternAtom(c, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	atoms[name] = reply.Atom
+	return reply.Atom, nil
+}
+
+// geometry reads the size of the window, and where it is on screen.
+func (win *xWindow) geometry(c *xgb.Conn, root xproto.Window) error {
+	geometry, err := xproto.GetGeometry(c, xproto.Drawable(win.id)).Reply()
+	if err != nil {
+		return fmt.Errorf("window %#x : %v", uint32(win.id), err)
+	}
+	onScreen, err := xproto.TranslateCoordinates(c, win.id, root, 0, 0).Reply()
+	if err != nil {
+		return fmt.Errorf("window %#x : %v", uint32(win.id), err)
+	}
+	win.x, win.y = int(onScreen.DstX), int(onScreen.DstY)
+	win.width, win.height = int(geometry.Width), int(geometry.Height)
+	return nil
+}
+
+// covering returns a window that is above win and overlaps rect (on screen), or nil if there is none.
+// A grab of win gets whatever covers it, or garbage, where it is covered.
+func (win *xWindow) covering(c *xgb.Conn, root xproto.Window, rect image.Rectangle) (*xWindow, error) {
+	// the windows stacked above win are the siblings above its top level window (its window
+	// manager's frame, if it has one), that is the child of root it is under
+	topLevel := win.id
+	for {
+		tree, err := xproto.QueryTree(c, topLevel).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("window %#x : %v", uint32(win.id), err)
+		}
+		if tree.Parent == root || tree.Parent == 0 {
+			break
+		}
+		topLevel = tree.Parent
+	}
+
+	tree, err := xproto.QueryTree(c, root).Reply()
+	if err != nil {
+		return nil, err
+	}
+	above := false
+	for _, child := range tree.Children { // bottom to top
+		if child == topLevel {
+			above = true
+			continue
+		}
+		if !above {
+			continue
+		}
+		attributes, err := xproto.GetWindowAttributes(c, child).Reply()
+		if err != nil || attributes.MapState != xproto.MapStateViewable || attributes.Class == xproto.WindowClassInputOnly {
+			continue // gone, not shown, or draws nothing
+		}
+		geometry, err := xproto.GetGeometry(c, xproto.Drawable(child)).Reply()
+		if err != nil {
+			continue
+		}
+		border := 2 * int(geometry.BorderWidth)
+		bounds := image.Rect(int(geometry.X), int(geometry.Y), int(geometry.X)+int(geometry.Width)+border, int(geometry.Y)+int(geometry.Height)+border)
+		if bounds.Overlaps(rect) {
+			name, _ := windowName(c, child)
+			if name == "" {
+				// a window manager's frame has no title, the window in it does
+				if windows, err := viewableWindows(c, child); err == nil && len(windows) > 0 {
+					name = windows[0].name
+				}
+			}
+			return &xWindow{id: child, name: name}, nil
+		}
+	}
+	return nil, nil
+}
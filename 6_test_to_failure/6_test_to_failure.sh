@@ -43,7 +43,7 @@ do
 
     cd ../4_extract_TEXT
 
-    go run 4_extract_Text.go
+    go run .
 
     kill -9 $pid_scroll_mock
 